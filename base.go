@@ -18,19 +18,32 @@ package swan
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
 
 	"github.com/SWAN-community/owid-go"
 )
 
-// Version used for persisting SWAN data structures.
-const typeVersion byte = 1
+// Versions used for persisting SWAN data structures. Each is the latest
+// version of the type and is used when writing unless a different version has
+// been set.
+const (
+	bidVersion         byte = 2
+	idVersion          byte = 2
+	failedVersion      byte = 1
+	emptyVersion       byte = 1
+	preferencesVersion byte = 1
+)
 
 // Type structures that include base.
 const (
-	typeBid    byte = iota
-	typeID     byte = iota
-	typeFailed byte = iota
-	typeEmpty  byte = iota
+	typeBid         byte = iota
+	typeID          byte = iota
+	typeFailed      byte = iota
+	typeEmpty       byte = iota
+	typePreferences byte = iota
 )
 
 // base used as the first fields of any SWAN data structure.
@@ -39,49 +52,135 @@ type base struct {
 	structType byte // Used to indicate the type of struct that follows.
 }
 
+// Payload is implemented by all the SWAN types that can be carried in the
+// payload of an OWID.
+type Payload interface {
+	// Type returns the byte used to identify the SWAN type in the payload.
+	// Must not depend on the receiver so that it can be called on a nil
+	// pointer.
+	Type() byte
+	// Version returns the version of the encoding used for the type.
+	Version() byte
+	// AsByteArray returns the type encoded as an OWID payload.
+	AsByteArray() ([]byte, error)
+	// Encode writes the type encoded as an OWID payload to the writer.
+	Encode(w io.Writer) error
+	// Decode sets the type from the OWID payload read from the reader. The
+	// payload can be in any of the supported formats.
+	Decode(r io.Reader) error
+	setFromBuffer(f *bytes.Buffer) error
+	setHeader(t byte, v byte)
+	fields() []field
+}
+
 // FromOWID returns a point to a structure of the SWAN type contained in the
-// OWID.
-func FromOWID(o *owid.OWID) (interface{}, error) {
-	var b base
-	f := bytes.NewBuffer(o.Payload)
-	err := b.setFromBuffer(f)
+// OWID. The payload can be in any of the supported formats.
+func FromOWID(o *owid.OWID) (Payload, error) {
+	return payloadFromBytes(o.Payload)
+}
+
+// FromNode returns a point to a structure of the SWAN type contained in the
+// Node's OWID.
+func FromNode(n *owid.Node) (Payload, error) {
+	o, err := n.GetOWID()
 	if err != nil {
 		return nil, err
 	}
-	var i interface{}
-	switch b.structType {
+	return FromOWID(o)
+}
+
+// ErrTypeMismatch is returned by Decode and DecodeNode when the payload
+// contains a different SWAN type to the one requested.
+var ErrTypeMismatch = errors.New("type mismatch")
+
+// Decode returns the SWAN type T contained in the OWID. T can be a pointer to
+// a SWAN type or an interface such as Payload. If the payload contains a SWAN
+// type that is not a T then an error wrapping ErrTypeMismatch is returned.
+func Decode[T Payload](o *owid.OWID) (T, error) {
+	var t T
+	p, err := FromOWID(o)
+	if err != nil {
+		return t, err
+	}
+	r, ok := p.(T)
+	if ok == false {
+		return t, fmt.Errorf(
+			"type %s not valid for %s: %w",
+			typeAsString(p.Type()),
+			reflect.TypeOf((*T)(nil)).Elem(),
+			ErrTypeMismatch)
+	}
+	return r, nil
+}
+
+// DecodeNode returns the SWAN type T contained in the Node's OWID. If the
+// payload contains a different SWAN type then an error is returned.
+func DecodeNode[T Payload](n *owid.Node) (T, error) {
+	o, err := n.GetOWID()
+	if err != nil {
+		var t T
+		return t, err
+	}
+	return Decode[T](o)
+}
+
+// Version returns the version of the encoding used for the type.
+func (b *base) Version() byte { return b.version }
+
+// setHeader sets the type and version read from a payload.
+func (b *base) setHeader(t byte, v byte) {
+	b.structType = t
+	b.version = v
+}
+
+// newPayload returns a new empty instance of the SWAN type t.
+func newPayload(t byte) (Payload, error) {
+	switch t {
 	case typeBid:
-		var v Bid
-		v.base = b
-		_ = v.setFromBufferVersion1(f)
-		i = &v
+		return &Bid{}, nil
 	case typeID:
-		var v ID
-		v.base = b
-		_ = v.setFromBufferVersion1(f)
-		i = &v
+		return &ID{}, nil
 	case typeFailed:
-		var v Failed
-		v.base = b
-		_ = v.setFromBufferVersion1(f)
-		i = &v
+		return &Failed{}, nil
 	case typeEmpty:
-		var v Empty
-		v.base = b
-		_ = v.setFromBuffer(f)
-		i = &v
+		return &Empty{}, nil
+	case typePreferences:
+		return &Preferences{}, nil
+	default:
+		return nil, fmt.Errorf("type '%d' not supported", t)
 	}
-	return i, nil
 }
 
-// FromNode returns a point to a structure of the SWAN type contained in the
-// Node's OWID.
-func FromNode(n *owid.Node) (interface{}, error) {
-	o, err := n.GetOWID()
-	if err != nil {
-		return nil, err
+// latestVersion returns the latest version of the SWAN type t.
+func latestVersion(t byte) byte {
+	switch t {
+	case typeBid:
+		return bidVersion
+	case typeID:
+		return idVersion
+	case typeFailed:
+		return failedVersion
+	case typeEmpty:
+		return emptyVersion
+	case typePreferences:
+		return preferencesVersion
+	default:
+		return 0
 	}
-	return FromOWID(o)
+}
+
+// setVersion sets the version of the encoding to use when the type t is next
+// written. Returns an error if the version is not between 1 and latest.
+func (b *base) setVersion(t byte, v byte, latest byte) error {
+	if v < 1 || v > latest {
+		return fmt.Errorf(
+			"version '%d' not supported for %s",
+			v,
+			typeAsString(t))
+	}
+	b.structType = t
+	b.version = v
+	return nil
 }
 
 func (b *base) writeToBuffer(f *bytes.Buffer) error {
@@ -119,6 +218,8 @@ func typeAsString(b byte) string {
 		return "Failed"
 	case typeEmpty:
 		return "Empty"
+	case typePreferences:
+		return "Preferences"
 	default:
 		return "Unknown"
 	}
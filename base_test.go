@@ -0,0 +1,63 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+func TestDecodeTypes(t *testing.T) {
+	b, err := testBid().AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := testOWID("dsp.com", b)
+
+	p, err := Decode[Payload](o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*Bid); ok == false {
+		t.Fatalf("'%T' expected *Bid", p)
+	}
+	d, err := Decode[*Bid](o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.MediaURL != testBid().MediaURL {
+		t.Fatalf("'%s' expected '%s'", d.MediaURL, testBid().MediaURL)
+	}
+	n, err := DecodeNode[Payload](testNode(t, testBid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Type() != typeBid {
+		t.Fatalf("type '%d' expected '%d'", n.Type(), typeBid)
+	}
+
+	i, err := Decode[*ID](o)
+	if errors.Is(err, ErrTypeMismatch) == false || i != nil {
+		t.Fatalf("'%v' '%v' expected '%v'", i, err, ErrTypeMismatch)
+	}
+	_, err = Decode[Payload](&owid.OWID{Payload: []byte{0xff}})
+	if err == nil {
+		t.Fatal("expected error for invalid payload")
+	}
+}
@@ -19,58 +19,185 @@ package swan
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"time"
 
 	"github.com/SWAN-community/owid-go"
 )
 
+// BidFormat is the format of the creative associated with a Bid.
+type BidFormat byte
+
+// Formats of creative that can be associated with a Bid.
+const (
+	BidFormatUnknown BidFormat = iota // Format not provided
+	BidFormatDisplay BidFormat = iota // Image or HTML display advert
+	BidFormatVideo   BidFormat = iota // Video advert
+	BidFormatNative  BidFormat = iota // Native advert rendered by the publisher
+)
+
+// Currency codes must be three upper case letters as per ISO 4217.
+var currencyRegex = regexp.MustCompile("^[A-Z]{3}$")
+
 // Bid contains the information about the advert to be displayed.
 type Bid struct {
 	base
 	MediaURL      string // The URL of the content of the advert provided in response
 	AdvertiserURL string // The URL to direct the browser to if the advert is selected
+	// The following fields are only persisted from version 2 onwards.
+	Price             float64   // The price of the advert in Currency units
+	Currency          string    // The ISO 4217 currency code for the Price
+	Width             uint16    // The width of the creative in pixels
+	Height            uint16    // The height of the creative in pixels
+	Format            BidFormat // The format of the creative
+	AdvertiserDomains []string  // The domains of the advertiser
+	CampaignID        string    // The advertiser's identifier for the campaign
+	CreativeID        string    // The advertiser's identifier for the creative
+	Expires           time.Time // The UTC time after which the bid is not valid
+}
+
+// String returns the name of the format.
+func (f BidFormat) String() string {
+	switch f {
+	case BidFormatDisplay:
+		return "display"
+	case BidFormatVideo:
+		return "video"
+	case BidFormatNative:
+		return "native"
+	default:
+		return "unknown"
+	}
 }
 
 // BidFromOWID returns a Bid created from the OWID payload.
 func BidFromOWID(i *owid.OWID) (*Bid, error) {
-	var b Bid
-	f := bytes.NewBuffer(i.Payload)
-	err := b.setFromBuffer(f)
-	if err != nil {
-		return nil, err
-	}
-	return &b, nil
+	return Decode[*Bid](i)
 }
 
 // BidFromNode returns a Bid created from the Node payload.
 func BidFromNode(n *owid.Node) (*Bid, error) {
-	var b Bid
-	o, err := n.GetOWID()
+	return DecodeNode[*Bid](n)
+}
+
+// Type returns the byte used to identify a Bid in an OWID payload.
+func (b *Bid) Type() byte { return typeBid }
+
+func (b *Bid) fields() []field {
+	return []field{
+		{1, "mediaUrl", &b.MediaURL},
+		{2, "advertiserUrl", &b.AdvertiserURL},
+		{3, "price", &b.Price},
+		{4, "currency", &b.Currency},
+		{5, "width", &b.Width},
+		{6, "height", &b.Height},
+		{7, "format", &b.Format},
+		{8, "advertiserDomains", &b.AdvertiserDomains},
+		{9, "campaignId", &b.CampaignID},
+		{10, "creativeId", &b.CreativeID},
+		{11, "expires", &b.Expires},
+	}
+}
+
+// SetVersion sets the version of the encoding to use when the Bid is written.
+// Used where the recipient of the Bid only supports an earlier version. Fields
+// that are not supported by the version are not written.
+func (b *Bid) SetVersion(v byte) error {
+	return b.base.setVersion(typeBid, v, bidVersion)
+}
+
+// IsExpired returns true if the Bid has an expiry time that has passed.
+func (b *Bid) IsExpired() bool {
+	return b.Expires.IsZero() == false && time.Now().After(b.Expires)
+}
+
+// Validate returns an error if the URLs are not absolute HTTP or HTTPS URLs or
+// if any of the other fields written for the version of the Bid are invalid.
+func (b *Bid) Validate() error {
+	err := validateAbsoluteURL("MediaURL", b.MediaURL)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	f := bytes.NewBuffer(o.Payload)
-	err = b.setFromBuffer(f)
+	err = validateAbsoluteURL("AdvertiserURL", b.AdvertiserURL)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if b.version == byte(1) {
+		return nil
+	}
+	if math.IsNaN(b.Price) || math.IsInf(b.Price, 0) || b.Price < 0 {
+		return fmt.Errorf("Price '%f' invalid", b.Price)
+	}
+	if b.Price != 0 && b.Currency == "" {
+		return fmt.Errorf("Currency required with Price")
+	}
+	if b.Currency != "" && currencyRegex.MatchString(b.Currency) == false {
+		return fmt.Errorf("Currency '%s' invalid", b.Currency)
+	}
+	if b.Format > BidFormatNative {
+		return fmt.Errorf("Format '%d' invalid", b.Format)
+	}
+	if b.Format == BidFormatDisplay || b.Format == BidFormatVideo {
+		if b.Width == 0 || b.Height == 0 {
+			return fmt.Errorf("Width and Height required for %s", b.Format)
+		}
+	}
+	for _, d := range b.AdvertiserDomains {
+		u, err := url.Parse("https://" + d)
+		if d == "" || err != nil || u.Host != d || u.Port() != "" {
+			return fmt.Errorf("AdvertiserDomains '%s' invalid", d)
+		}
 	}
-	return &b, nil
+	return nil
+}
+
+// Encode writes the Bid to the writer.
+func (b *Bid) Encode(w io.Writer) error {
+	return encode(w, b)
+}
+
+// Decode sets the Bid from the data read from the reader in any of the
+// supported formats. No more than MaxPayloadLength bytes are read.
+func (b *Bid) Decode(r io.Reader) error {
+	*b = Bid{}
+	return decode(r, b)
 }
 
 // AsByteArray returns the Bid as a byte array.
 func (b *Bid) AsByteArray() ([]byte, error) {
 	var f bytes.Buffer
-	b.writeToBuffer(&f)
+	err := b.writeToBuffer(&f)
+	if err != nil {
+		return nil, err
+	}
 	return f.Bytes(), nil
 }
 
 func (b *Bid) writeToBuffer(f *bytes.Buffer) error {
-	b.version = typeVersion
+	if b.version == 0 {
+		b.version = bidVersion
+	}
 	b.structType = typeBid
 	err := b.base.writeToBuffer(f)
 	if err != nil {
 		return err
 	}
-	err = writeString(f, b.MediaURL)
+	switch b.version {
+	case byte(1):
+		err = b.writeToBufferVersion1(f)
+	case byte(2):
+		err = b.writeToBufferVersion2(f)
+	default:
+		err = fmt.Errorf("Version '%d' not supported", b.version)
+	}
+	return err
+}
+
+func (b *Bid) writeToBufferVersion1(f *bytes.Buffer) error {
+	err := writeString(f, b.MediaURL)
 	if err != nil {
 		return err
 	}
@@ -81,6 +208,50 @@ func (b *Bid) writeToBuffer(f *bytes.Buffer) error {
 	return nil
 }
 
+func (b *Bid) writeToBufferVersion2(f *bytes.Buffer) error {
+	err := b.writeToBufferVersion1(f)
+	if err != nil {
+		return err
+	}
+	err = writeFloat64(f, b.Price)
+	if err != nil {
+		return err
+	}
+	err = writeString(f, b.Currency)
+	if err != nil {
+		return err
+	}
+	err = writeUint16(f, b.Width)
+	if err != nil {
+		return err
+	}
+	err = writeUint16(f, b.Height)
+	if err != nil {
+		return err
+	}
+	err = writeByte(f, byte(b.Format))
+	if err != nil {
+		return err
+	}
+	err = writeStrings(f, b.AdvertiserDomains)
+	if err != nil {
+		return err
+	}
+	err = writeString(f, b.CampaignID)
+	if err != nil {
+		return err
+	}
+	err = writeString(f, b.CreativeID)
+	if err != nil {
+		return err
+	}
+	err = writeTime(f, b.Expires)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (b *Bid) setFromBuffer(f *bytes.Buffer) error {
 	err := b.base.setFromBuffer(f)
 	if err != nil {
@@ -96,11 +267,17 @@ func (b *Bid) setFromBuffer(f *bytes.Buffer) error {
 	case byte(1):
 		err = b.setFromBufferVersion1(f)
 		break
+	case byte(2):
+		err = b.setFromBufferVersion2(f)
+		break
 	default:
 		err = fmt.Errorf("Version '%d' not supported", b.base.version)
 		break
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return checkTrailing(f)
 }
 
 func (b *Bid) setFromBufferVersion1(f *bytes.Buffer) error {
@@ -115,3 +292,64 @@ func (b *Bid) setFromBufferVersion1(f *bytes.Buffer) error {
 	}
 	return nil
 }
+
+func (b *Bid) setFromBufferVersion2(f *bytes.Buffer) error {
+	err := b.setFromBufferVersion1(f)
+	if err != nil {
+		return err
+	}
+	b.Price, err = readFloat64(f)
+	if err != nil {
+		return err
+	}
+	b.Currency, err = readString(f)
+	if err != nil {
+		return err
+	}
+	b.Width, err = readUint16(f)
+	if err != nil {
+		return err
+	}
+	b.Height, err = readUint16(f)
+	if err != nil {
+		return err
+	}
+	m, err := readByte(f)
+	if err != nil {
+		return err
+	}
+	b.Format = BidFormat(m)
+	b.AdvertiserDomains, err = readStrings(f)
+	if err != nil {
+		return err
+	}
+	b.CampaignID, err = readString(f)
+	if err != nil {
+		return err
+	}
+	b.CreativeID, err = readString(f)
+	if err != nil {
+		return err
+	}
+	b.Expires, err = readTime(f)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateAbsoluteURL returns an error if the value v of the field n is not an
+// absolute HTTP or HTTPS URL.
+func validateAbsoluteURL(n string, v string) error {
+	if v == "" {
+		return fmt.Errorf("%s required", n)
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return fmt.Errorf("%s '%s' invalid: %s", n, v, err.Error())
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s '%s' must be absolute HTTP or HTTPS URL", n, v)
+	}
+	return nil
+}
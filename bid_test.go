@@ -0,0 +1,56 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"testing"
+)
+
+// Golden byte vectors for the Bid returned from testBid.
+const (
+	testBidVersion1 = "" +
+		"010068747470733a2f2f63646e2e616476657274697365722e636f6d2f61642e" +
+		"706e670068747470733a2f2f616476657274697365722e636f6d2f6f66666572" +
+		"00"
+	testBidVersion2 = "" +
+		"020068747470733a2f2f63646e2e616476657274697365722e636f6d2f61642e" +
+		"706e670068747470733a2f2f616476657274697365722e636f6d2f6f66666572" +
+		"00000000000000f43f47425000d8025a00010200616476657274697365722e63" +
+		"6f6d006272616e642e636f6d0063616d706169676e2d31006372656174697665" +
+		"2d320080b31e6200000000"
+)
+
+func TestBidGoldenVersion1(t *testing.T) {
+	b := testBid()
+	err := b.SetVersion(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGolden(t, b, testBidVersion1)
+	e := &Bid{
+		MediaURL:      b.MediaURL,
+		AdvertiserURL: b.AdvertiserURL}
+	e.setHeader(typeBid, 1)
+	testGoldenDecode(t, e, testBidVersion1)
+}
+
+func TestBidGoldenVersion2(t *testing.T) {
+	testGolden(t, testBid(), testBidVersion2)
+	e := testBid()
+	e.setHeader(typeBid, 2)
+	testGoldenDecode(t, e, testBidVersion2)
+}
@@ -0,0 +1,268 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// bitWriter writes values of any number of bits most significant bit first as
+// used by the IAB TCF and GPP strings. The first error is retained and all
+// further writes are ignored.
+type bitWriter struct {
+	b   []byte
+	n   int // Number of bits written
+	err error
+}
+
+// bitReader reads values written by a bitWriter. The first error is retained
+// and all further reads return zero.
+type bitReader struct {
+	b   []byte
+	n   int // Number of bits read
+	err error
+}
+
+func (w *bitWriter) writeBits(v uint64, l int) {
+	if w.err != nil {
+		return
+	}
+	if l < 64 && v >= 1<<l {
+		w.err = fmt.Errorf("value '%d' exceeds '%d' bits: %w", v, l, ErrTooLong)
+		return
+	}
+	for i := l - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		if v&(1<<i) != 0 {
+			w.b[w.n/8] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) writeInt(v int, l int) {
+	if v < 0 {
+		if w.err == nil {
+			w.err = fmt.Errorf("value '%d' negative", v)
+		}
+		return
+	}
+	w.writeBits(uint64(v), l)
+}
+
+func (w *bitWriter) writeBool(v bool) {
+	if v {
+		w.writeBits(1, 1)
+	} else {
+		w.writeBits(0, 1)
+	}
+}
+
+// writeDeciseconds writes the time as the number of deciseconds since the Unix
+// epoch in 36 bits.
+func (w *bitWriter) writeDeciseconds(t time.Time) {
+	if t.IsZero() {
+		w.writeBits(0, 36)
+		return
+	}
+	w.writeInt(int(t.UnixNano()/int64(100*time.Millisecond)), 36)
+}
+
+// writeLetters writes the upper case letters of s in 6 bits each where A is 0.
+func (w *bitWriter) writeLetters(s string, l int) {
+	if len(s) != l {
+		if w.err == nil {
+			w.err = fmt.Errorf("'%s' must be %d letters", s, l)
+		}
+		return
+	}
+	for _, c := range strings.ToUpper(s) {
+		if c < 'A' || c > 'Z' {
+			if w.err == nil {
+				w.err = fmt.Errorf("'%s' must only contain letters", s)
+			}
+			return
+		}
+		w.writeBits(uint64(c-'A'), 6)
+	}
+}
+
+// writeBitField writes l bits where bit i, counting from 1, is set if i is in
+// the list of ids.
+func (w *bitWriter) writeBitField(ids []int, l int) {
+	for i := 1; i <= l; i++ {
+		w.writeBool(containsInt(ids, i))
+	}
+}
+
+// writeFibonacci writes the positive integer v using Fibonacci coding where
+// each bit represents a Fibonacci number starting from 1, 2, 3, 5 and the
+// value ends with two consecutive set bits.
+func (w *bitWriter) writeFibonacci(v int) {
+	if v < 1 {
+		if w.err == nil {
+			w.err = fmt.Errorf("fibonacci value '%d' must be positive", v)
+		}
+		return
+	}
+	f := []int{1, 2}
+	for f[len(f)-1] <= v {
+		f = append(f, f[len(f)-1]+f[len(f)-2])
+	}
+	f = f[:len(f)-1]
+	b := make([]bool, len(f))
+	for i := len(f) - 1; i >= 0; i-- {
+		if f[i] <= v {
+			b[i] = true
+			v -= f[i]
+		}
+	}
+	for _, i := range b {
+		w.writeBool(i)
+	}
+	w.writeBool(true)
+}
+
+// asBase64 returns the bits written as URL safe base 64 without padding.
+func (w *bitWriter) asBase64() (string, error) {
+	if w.err != nil {
+		return "", w.err
+	}
+	return base64.RawURLEncoding.EncodeToString(w.b), nil
+}
+
+// newBitReader returns a reader for the URL safe base 64 string s. Padding is
+// optional.
+func newBitReader(s string) (*bitReader, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return &bitReader{b: b}, nil
+}
+
+func (r *bitReader) readBits(l int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if r.n+l > len(r.b)*8 {
+		r.err = fmt.Errorf(
+			"'%d' bits remaining for '%d' bits: %w",
+			len(r.b)*8-r.n,
+			l,
+			ErrShortRead)
+		return 0
+	}
+	var v uint64
+	for i := 0; i < l; i++ {
+		v <<= 1
+		if r.b[r.n/8]&(0x80>>(r.n%8)) != 0 {
+			v |= 1
+		}
+		r.n++
+	}
+	return v
+}
+
+func (r *bitReader) readInt(l int) int {
+	return int(r.readBits(l))
+}
+
+func (r *bitReader) readBool() bool {
+	return r.readBits(1) == 1
+}
+
+func (r *bitReader) readDeciseconds() time.Time {
+	v := r.readBits(36)
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(v)*int64(100*time.Millisecond)).UTC()
+}
+
+func (r *bitReader) readLetters(l int) string {
+	var s strings.Builder
+	for i := 0; i < l; i++ {
+		v := r.readBits(6)
+		if v > 25 {
+			if r.err == nil {
+				r.err = fmt.Errorf("letter '%d' invalid", v)
+			}
+			return ""
+		}
+		s.WriteByte(byte('A' + v))
+	}
+	return s.String()
+}
+
+// readFibonacci reads a positive integer written by writeFibonacci.
+func (r *bitReader) readFibonacci() int {
+	a, b := 1, 2
+	v := 0
+	p := false
+	for r.err == nil {
+		c := r.readBool()
+		if c && p {
+			return v
+		}
+		if c {
+			v += a
+		}
+		if b > 1<<30 {
+			r.err = fmt.Errorf("fibonacci value too large: %w", ErrTooLong)
+			break
+		}
+		a, b = b, a+b
+		p = c
+	}
+	return 0
+}
+
+// readBitField returns the ids, counting from 1, of the bits that are set in
+// the next l bits.
+func (r *bitReader) readBitField(l int) []int {
+	var ids []int
+	for i := 1; i <= l; i++ {
+		if r.readBool() {
+			ids = append(ids, i)
+		}
+	}
+	if r.err != nil {
+		return nil
+	}
+	return ids
+}
+
+// remaining returns the number of bits that have not been read.
+func (r *bitReader) remaining() int {
+	return len(r.b)*8 - r.n
+}
+
+// containsInt returns true if the list of integers contains v.
+func containsInt(l []int, v int) bool {
+	for _, i := range l {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,526 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// CBOR major types from RFC 8949 section 3.1.
+const (
+	cborUint   byte = 0
+	cborNegint byte = 1
+	cborBytes  byte = 2
+	cborText   byte = 3
+	cborArray  byte = 4
+	cborMap    byte = 5
+	cborTag    byte = 6
+	cborSimple byte = 7
+)
+
+// CBOR simple values and the tag used for epoch based date times.
+const (
+	cborFalse     uint64 = 20
+	cborTrue      uint64 = 21
+	cborNull      uint64 = 22
+	cborTagEpoch  uint64 = 1
+	cborMaxNested int    = 8 // Deepest nesting of items that will be skipped
+)
+
+// cborReader reads CBOR data items from a byte array. Only definite length
+// items are supported.
+type cborReader struct {
+	d []byte
+}
+
+// marshalCBOR returns the payload as a self-described CBOR map. The type and
+// version are included in the map along with any fields that are not empty.
+func marshalCBOR(p Payload) ([]byte, error) {
+	var f bytes.Buffer
+	f.Write(markerCBOR)
+	var s []field
+	for _, i := range p.fields() {
+		if isEmptyField(i.value) == false {
+			s = append(s, i)
+		}
+	}
+	t, v := header(p)
+	cborWriteHead(&f, cborMap, uint64(len(s)+2))
+	cborWriteText(&f, cborKeyType)
+	cborWriteHead(&f, cborUint, uint64(t))
+	cborWriteText(&f, cborKeyVersion)
+	cborWriteHead(&f, cborUint, uint64(v))
+	for _, i := range s {
+		cborWriteText(&f, i.name)
+		err := cborWriteValue(&f, i.value)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %w", i.name, err)
+		}
+	}
+	return f.Bytes(), nil
+}
+
+// unmarshalCBOR returns the SWAN data structure in the CBOR map. Keys that are
+// not known are ignored.
+func unmarshalCBOR(d []byte) (Payload, error) {
+	r := cborReader{d: d}
+	m, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if m != cborMap {
+		return nil, fmt.Errorf("CBOR payload must be a map")
+	}
+	if n > uint64(len(r.d)) {
+		return nil, fmt.Errorf("CBOR map of '%d' items: %w", n, ErrShortRead)
+	}
+	values := make(map[string][]byte, n)
+	for i := uint64(0); i < n; i++ {
+		k, err := r.text()
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.item()
+		if err != nil {
+			return nil, fmt.Errorf("key '%s': %w", k, err)
+		}
+		if _, ok := values[k]; ok {
+			return nil, fmt.Errorf("key '%s' duplicated", k)
+		}
+		values[k] = v
+	}
+	if len(r.d) != 0 {
+		return nil, fmt.Errorf("'%d' bytes: %w", len(r.d), ErrTrailingData)
+	}
+	t, err := cborUintFromItem(values, cborKeyType)
+	if err != nil {
+		return nil, err
+	}
+	v, err := cborUintFromItem(values, cborKeyVersion)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPayloadWithHeader(t, v)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range p.fields() {
+		if b, ok := values[i.name]; ok {
+			r := cborReader{d: b}
+			err = r.value(i.value)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s': %w", i.name, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+func cborUintFromItem(values map[string][]byte, k string) (uint64, error) {
+	b, ok := values[k]
+	if ok == false {
+		return 0, fmt.Errorf("key '%s' missing", k)
+	}
+	r := cborReader{d: b}
+	m, n, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	if m != cborUint {
+		return 0, fmt.Errorf("key '%s' must be unsigned integer", k)
+	}
+	return n, nil
+}
+
+func cborWriteHead(f *bytes.Buffer, m byte, n uint64) {
+	m <<= 5
+	switch {
+	case n < 24:
+		f.WriteByte(m | byte(n))
+	case n <= math.MaxUint8:
+		f.WriteByte(m | 24)
+		cborWriteBigEndian(f, n, 1)
+	case n <= math.MaxUint16:
+		f.WriteByte(m | 25)
+		cborWriteBigEndian(f, n, 2)
+	case n <= math.MaxUint32:
+		f.WriteByte(m | 26)
+		cborWriteBigEndian(f, n, 4)
+	default:
+		f.WriteByte(m | 27)
+		cborWriteBigEndian(f, n, 8)
+	}
+}
+
+// cborWriteBigEndian writes the l least significant bytes of n most
+// significant first.
+func cborWriteBigEndian(f *bytes.Buffer, n uint64, l int) {
+	for i := l - 1; i >= 0; i-- {
+		f.WriteByte(byte(n >> (8 * i)))
+	}
+}
+
+func cborWriteText(f *bytes.Buffer, s string) {
+	cborWriteHead(f, cborText, uint64(len(s)))
+	f.WriteString(s)
+}
+
+func cborWriteInt(f *bytes.Buffer, i int64) {
+	if i < 0 {
+		cborWriteHead(f, cborNegint, uint64(-1-i))
+	} else {
+		cborWriteHead(f, cborUint, uint64(i))
+	}
+}
+
+func cborWriteValue(f *bytes.Buffer, v interface{}) error {
+	switch p := v.(type) {
+	case *string:
+		cborWriteText(f, *p)
+	case *[]byte:
+		cborWriteHead(f, cborBytes, uint64(len(*p)))
+		f.Write(*p)
+	case *[]string:
+		cborWriteHead(f, cborArray, uint64(len(*p)))
+		for _, s := range *p {
+			cborWriteText(f, s)
+		}
+	case *uint16:
+		cborWriteHead(f, cborUint, uint64(*p))
+	case *float64:
+		f.WriteByte(cborSimple<<5 | 27)
+		cborWriteBigEndian(f, math.Float64bits(*p), 8)
+	case *bool:
+		if *p {
+			cborWriteHead(f, cborSimple, cborTrue)
+		} else {
+			cborWriteHead(f, cborSimple, cborFalse)
+		}
+	case *BidFormat:
+		cborWriteHead(f, cborUint, uint64(*p))
+	case *time.Time:
+		s, err := timeAsUnix(*p)
+		if err != nil {
+			return err
+		}
+		cborWriteHead(f, cborTag, cborTagEpoch)
+		cborWriteInt(f, s)
+	case *time.Duration:
+		s, err := durationAsSeconds(*p)
+		if err != nil {
+			return err
+		}
+		cborWriteHead(f, cborUint, uint64(s))
+	case **owid.OWID:
+		b, err := (*p).AsByteArray()
+		if err != nil {
+			return err
+		}
+		cborWriteHead(f, cborBytes, uint64(len(b)))
+		f.Write(b)
+	default:
+		return fmt.Errorf("type '%T' not supported", v)
+	}
+	return nil
+}
+
+// head reads the initial byte and argument of the next data item. For floating
+// point values the argument is the bits of the value.
+func (r *cborReader) head() (byte, uint64, error) {
+	if len(r.d) == 0 {
+		return 0, 0, fmt.Errorf("CBOR item: %w", ErrShortRead)
+	}
+	m := r.d[0] >> 5
+	a := r.d[0] & 0x1F
+	r.d = r.d[1:]
+	var l int
+	switch {
+	case a < 24:
+		return m, uint64(a), nil
+	case a == 24:
+		l = 1
+	case a == 25:
+		l = 2
+	case a == 26:
+		l = 4
+	case a == 27:
+		l = 8
+	default:
+		return 0, 0, fmt.Errorf(
+			"CBOR additional information '%d' not supported",
+			a)
+	}
+	if len(r.d) < l {
+		return 0, 0, fmt.Errorf("CBOR argument: %w", ErrShortRead)
+	}
+	var n uint64
+	for _, b := range r.d[:l] {
+		n = n<<8 | uint64(b)
+	}
+	r.d = r.d[l:]
+	return m, n, nil
+}
+
+// content returns the next n bytes of a byte or text string if they are
+// within the limit l.
+func (r *cborReader) content(n uint64, l int) ([]byte, error) {
+	if n > uint64(l) {
+		return nil, fmt.Errorf("'%d' bytes exceeds '%d': %w", n, l, ErrTooLong)
+	}
+	if n > uint64(len(r.d)) {
+		return nil, fmt.Errorf("CBOR string: %w", ErrShortRead)
+	}
+	b := r.d[:n]
+	r.d = r.d[n:]
+	return b, nil
+}
+
+func (r *cborReader) text() (string, error) {
+	m, n, err := r.head()
+	if err != nil {
+		return "", err
+	}
+	if m != cborText {
+		return "", fmt.Errorf("CBOR text string expected")
+	}
+	b, err := r.content(n, MaxStringLength)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// item returns the bytes of the next data item including any nested items.
+func (r *cborReader) item() ([]byte, error) {
+	s := r.d
+	err := r.skip(0)
+	if err != nil {
+		return nil, err
+	}
+	return s[:len(s)-len(r.d)], nil
+}
+
+func (r *cborReader) skip(depth int) error {
+	if depth > cborMaxNested {
+		return fmt.Errorf("CBOR nesting exceeds '%d'", cborMaxNested)
+	}
+	m, n, err := r.head()
+	if err != nil {
+		return err
+	}
+	switch m {
+	case cborBytes, cborText:
+		_, err = r.content(n, MaxPayloadLength)
+	case cborArray, cborMap:
+		if m == cborMap {
+			n *= 2
+		}
+		if n > uint64(len(r.d)) {
+			return fmt.Errorf("CBOR container: %w", ErrShortRead)
+		}
+		for i := uint64(0); i < n && err == nil; i++ {
+			err = r.skip(depth + 1)
+		}
+	case cborTag:
+		err = r.skip(depth + 1)
+	}
+	return err
+}
+
+func (r *cborReader) uint(max uint64) (uint64, error) {
+	m, n, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	if m != cborUint {
+		return 0, fmt.Errorf("CBOR unsigned integer expected")
+	}
+	if n > max {
+		return 0, fmt.Errorf("'%d' exceeds '%d'", n, max)
+	}
+	return n, nil
+}
+
+func (r *cborReader) float() (float64, error) {
+	if len(r.d) == 0 {
+		return 0, fmt.Errorf("CBOR float: %w", ErrShortRead)
+	}
+	a := r.d[0] & 0x1F
+	m, n, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case m == cborUint:
+		return float64(n), nil
+	case m == cborNegint:
+		return -1 - float64(n), nil
+	case m == cborSimple && a == 25:
+		return float16(uint16(n)), nil
+	case m == cborSimple && a == 26:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case m == cborSimple && a == 27:
+		return math.Float64frombits(n), nil
+	}
+	return 0, fmt.Errorf("CBOR number expected")
+}
+
+// value sets the member pointed to by v from the next data item.
+func (r *cborReader) value(v interface{}) error {
+	switch p := v.(type) {
+	case *string:
+		s, err := r.text()
+		if err != nil {
+			return err
+		}
+		*p = s
+	case *[]byte:
+		m, n, err := r.head()
+		if err != nil {
+			return err
+		}
+		if m != cborBytes {
+			return fmt.Errorf("CBOR byte string expected")
+		}
+		b, err := r.content(n, MaxByteArrayLength)
+		if err != nil {
+			return err
+		}
+		*p = append([]byte(nil), b...)
+	case *[]string:
+		m, n, err := r.head()
+		if err != nil {
+			return err
+		}
+		if m != cborArray {
+			return fmt.Errorf("CBOR array expected")
+		}
+		if n > uint64(MaxArrayLength) {
+			return fmt.Errorf("'%d' items exceeds '%d': %w",
+				n,
+				MaxArrayLength,
+				ErrTooLong)
+		}
+		if n > uint64(len(r.d)) {
+			return fmt.Errorf("CBOR array: %w", ErrShortRead)
+		}
+		*p = make([]string, 0, n)
+		for i := uint64(0); i < n; i++ {
+			s, err := r.text()
+			if err != nil {
+				return err
+			}
+			*p = append(*p, s)
+		}
+	case *uint16:
+		n, err := r.uint(math.MaxUint16)
+		if err != nil {
+			return err
+		}
+		*p = uint16(n)
+	case *float64:
+		n, err := r.float()
+		if err != nil {
+			return err
+		}
+		*p = n
+	case *bool:
+		m, n, err := r.head()
+		if err != nil {
+			return err
+		}
+		if m != cborSimple || (n != cborTrue && n != cborFalse) {
+			return fmt.Errorf("CBOR boolean expected")
+		}
+		*p = n == cborTrue
+	case *BidFormat:
+		n, err := r.uint(math.MaxUint8)
+		if err != nil {
+			return err
+		}
+		*p = BidFormat(n)
+	case *time.Time:
+		if len(r.d) > 0 && r.d[0] == cborTag<<5|byte(cborTagEpoch) {
+			r.d = r.d[1:]
+		}
+		n, err := r.float()
+		if err != nil {
+			return err
+		}
+		if !(n >= minUnixTime && n <= maxUnixTime) {
+			return fmt.Errorf("time '%f' out of range", n)
+		}
+		*p, err = timeFromUnix(int64(n))
+		if err != nil {
+			return err
+		}
+	case *time.Duration:
+		n, err := r.uint(math.MaxUint32)
+		if err != nil {
+			return err
+		}
+		*p = time.Duration(n) * time.Second
+	case **owid.OWID:
+		if len(r.d) > 0 && r.d[0] == cborSimple<<5|byte(cborNull) {
+			*p = nil
+			return nil
+		}
+		var b []byte
+		err := r.value(&b)
+		if err != nil {
+			return err
+		}
+		*p, err = owidFromBytes(b)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("type '%T' not supported", v)
+	}
+	if len(r.d) != 0 {
+		return fmt.Errorf("'%d' bytes: %w", len(r.d), ErrTrailingData)
+	}
+	return nil
+}
+
+// float16 returns the IEEE 754 half precision value as a float64.
+func float16(h uint16) float64 {
+	e := int(h>>10) & 0x1F
+	m := float64(h & 0x3FF)
+	var v float64
+	switch e {
+	case 0:
+		v = math.Ldexp(m, -24)
+	case 0x1F:
+		if m == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(m+1024, e-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,97 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Buffers larger than this number of bytes are not returned to the pool to
+// avoid retaining memory used for an occasional large payload.
+const maxPooledBufferSize = 16384
+
+// Scratch buffers used to encode and decode SWAN data structures.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// encoder is implemented by all the SWAN data structures.
+type encoder interface {
+	writeToBuffer(f *bytes.Buffer) error
+}
+
+func getBuffer() *bytes.Buffer {
+	f := bufferPool.Get().(*bytes.Buffer)
+	f.Reset()
+	return f
+}
+
+func putBuffer(f *bytes.Buffer) {
+	if f.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(f)
+	}
+}
+
+// encode writes the encoder e to the writer w using a pooled scratch buffer.
+func encode(w io.Writer, e encoder) error {
+	f := getBuffer()
+	defer putBuffer(f)
+	err := e.writeToBuffer(f)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteTo(w)
+	return err
+}
+
+// decode reads the payload p from the reader r using a pooled scratch buffer.
+// No more than MaxPayloadLength bytes are read. The payload can be in any of
+// the supported formats. The values set in p must not alias the scratch
+// buffer.
+func decode(r io.Reader, p Payload) error {
+	f := getBuffer()
+	defer putBuffer(f)
+	_, err := f.ReadFrom(io.LimitReader(r, int64(MaxPayloadLength)+1))
+	if err != nil {
+		return err
+	}
+	if f.Len() > MaxPayloadLength {
+		return fmt.Errorf(
+			"payload exceeds '%d' bytes: %w",
+			MaxPayloadLength,
+			ErrTooLong)
+	}
+	if PayloadFormat(f.Bytes()) == FormatBinary {
+		return p.setFromBuffer(f)
+	}
+	d, err := payloadFromBytes(f.Bytes())
+	if err != nil {
+		return err
+	}
+	if d.Type() != p.Type() {
+		return fmt.Errorf(
+			"type %s not valid for %s",
+			typeAsString(d.Type()),
+			typeAsString(p.Type()))
+	}
+	reflect.ValueOf(p).Elem().Set(reflect.ValueOf(d).Elem())
+	return nil
+}
@@ -0,0 +1,93 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// The benchmarks compare the pooled Encode and Decode with AsByteArray and
+// FromOWID. Run with go test -bench . -benchmem.
+
+func BenchmarkEncode(b *testing.B) {
+	i := testID()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		err := i.Encode(io.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAsByteArray(b *testing.B) {
+	i := testID()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_, err := i.AsByteArray()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	d, err := testID().AsByteArray()
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(d)
+	var i ID
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		r.Reset(d)
+		err := i.Decode(r)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFromOWID(b *testing.B) {
+	d, err := testID().AsByteArray()
+	if err != nil {
+		b.Fatal(err)
+	}
+	o := &owid.OWID{Payload: d}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_, err := FromOWID(o)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestEncodeAllocations checks that Encode allocates less than AsByteArray as
+// the scratch buffer is reused.
+func TestEncodeAllocations(t *testing.T) {
+	i := testID()
+	e := testing.AllocsPerRun(100, func() { i.Encode(io.Discard) })
+	a := testing.AllocsPerRun(100, func() { i.AsByteArray() })
+	if e >= a {
+		t.Fatalf("Encode '%f' allocations not less than AsByteArray '%f'", e, a)
+	}
+}
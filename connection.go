@@ -22,6 +22,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/SWAN-community/swift-go"
 
@@ -88,6 +90,13 @@ type Operation struct {
 	// example; passing information between a Publisher and User Interface
 	// Provider such as a CMP in the storage operation.
 	State []string
+	// Optional signer used to add a signature to the State so that the party
+	// that retrieves the results can verify the State has not been modified
+	// with a StateVerifier.
+	StateSigner StateSigner
+	// Policy set with Connection.SetReturnURLPolicy that the ReturnUrl must
+	// meet. Not exported so that it can not be changed by operations.
+	returnURLPolicy *ReturnURLPolicy
 }
 
 // Update operation from a User Interface Provider where the preferences, email
@@ -95,12 +104,29 @@ type Operation struct {
 // swan.CreateSWID.
 type Update struct {
 	Operation
-	swid  *owid.OWID
-	pref  *owid.OWID
-	email *owid.OWID
-	salt  *owid.OWID
+	// Patch true if fields that have not been set or cleared should be left
+	// unchanged. Otherwise they are removed from SWAN. Default false.
+	Patch      bool
+	swid       *owid.OWID
+	pref       *owid.OWID
+	email      *owid.OWID
+	salt       *owid.OWID
+	clearSWID  bool
+	clearPref  bool
+	clearEmail bool
+	clearSalt  bool
 }
 
+// Change is how an Update operation changes a SWAN field.
+type Change byte
+
+// Changes that an Update operation can make to a SWAN field.
+const (
+	ChangeNone  Change = iota // The field is left unchanged
+	ChangeSet   Change = iota // The field is set to a new value
+	ChangeClear Change = iota // The field is removed
+)
+
 // Fetch operation to retrieve the SWAN data for use with a call to Decrypt or
 // DecryptRaw.
 type Fetch struct {
@@ -108,10 +134,30 @@ type Fetch struct {
 	Existing []*Pair // Existing SWAN data pairs
 }
 
-// Stop operation to block an advert domain or identifier.
+// Stop operation to block advert domains or identifiers, or to remove them
+// from the stop list if Unstop is true.
 type Stop struct {
 	Operation
-	Host string // Advert host to block
+	Host    string   // Advert host to block
+	Hosts   []string // Further advert hosts to block
+	Adverts []string // Base 64 OWIDs of adverts to block
+	Unstop  bool     // True to remove the hosts and adverts from the stop list
+}
+
+// Reset operation to remove all the SWAN data for the web browser from the
+// network including the SWID, SID, preferences, email, salt and stop list.
+type Reset struct {
+	Operation
+}
+
+// Keys in the values of an Update that are specific to this party or web
+// browser and must never be shared.
+var updatePrivateKeys = []string{
+	"accessKey", // Known only to this party and must never be shared
+	"swid",      // Not to be shared with other browsers
+	// Used for home node operations that depend on the specific browser
+	"remoteAddr",
+	"X-Forwarded-For",
 }
 
 // Connection stores the static details that are used when creating a new swan
@@ -121,10 +167,22 @@ type Connection struct {
 }
 
 // NewConnection creates a new SWAN connection based on the operation provided.
+// The operation provides the defaults for all the operations created from the
+// connection and can be overridden for each operation with options. The State
+// is copied so that later changes to the operation provided do not alter the
+// defaults.
 func NewConnection(operation Operation) *Connection {
+	operation.State = copyStrings(operation.State)
 	return &Connection{operation: operation}
 }
 
+// SetReturnURLPolicy sets the policy that the return URLs of all operations
+// created from the connection must meet. Operations with a return URL that is
+// not allowed return a *ValidationError from GetURL. Nil removes the policy.
+func (c *Connection) SetReturnURLPolicy(p *ReturnURLPolicy) {
+	c.operation.returnURLPolicy = p
+}
+
 // NewFetch creates a new fetch operation using the default in the connection.
 //
 // request http request from a web browser
@@ -133,12 +191,15 @@ func NewConnection(operation Operation) *Connection {
 //
 // existing if any values already exist then use these if none are available in
 // SWAN
+//
+// opts override the defaults in the connection for this operation only
 func (c *Connection) NewFetch(
 	request *http.Request,
 	returnUrl string,
-	existing []*Pair) *Fetch {
+	existing []*Pair,
+	opts ...Option) *Fetch {
 	f := Fetch{}
-	f.Operation = c.operation
+	f.Operation = c.newOperation(opts)
 	f.Request = request
 	f.ReturnUrl = returnUrl
 	f.Existing = existing
@@ -150,11 +211,14 @@ func (c *Connection) NewFetch(
 // request http request from a web browser
 //
 // returnUrl return URL after the operation completes
+//
+// opts override the defaults in the connection for this operation only
 func (c *Connection) NewUpdate(
 	request *http.Request,
-	returnUrl string) *Update {
+	returnUrl string,
+	opts ...Option) *Update {
 	p := Update{}
-	p.Operation = c.operation
+	p.Operation = c.newOperation(opts)
 	p.Request = request
 	p.ReturnUrl = returnUrl
 	return &p
@@ -167,18 +231,140 @@ func (c *Connection) NewUpdate(
 // returnUrl return URL after the operation completes
 //
 // host associated with the advert to stop
+//
+// opts override the defaults in the connection for this operation only
 func (c *Connection) NewStop(
 	request *http.Request,
 	returnUrl string,
-	host string) *Stop {
+	host string,
+	opts ...Option) *Stop {
 	s := Stop{}
-	s.Operation = c.operation
+	s.Operation = c.newOperation(opts)
 	s.Request = request
 	s.ReturnUrl = returnUrl
 	s.Host = host
 	return &s
 }
 
+// NewUnstop creates a new stop operation using the default in the connection
+// that removes the hosts from the stop list.
+//
+// request http request from a web browser
+//
+// returnUrl return URL after the operation completes
+//
+// hosts associated with the adverts to no longer stop
+//
+// opts override the defaults in the connection for this operation only
+func (c *Connection) NewUnstop(
+	request *http.Request,
+	returnUrl string,
+	hosts []string,
+	opts ...Option) *Stop {
+	s := Stop{}
+	s.Operation = c.newOperation(opts)
+	s.Request = request
+	s.ReturnUrl = returnUrl
+	s.Hosts = hosts
+	s.Unstop = true
+	return &s
+}
+
+// NewStopFromBid creates a new stop operation using the default in the
+// connection for the advertiser of the bid. The host is derived from the
+// AdvertiserURL of the bid, or the first of the AdvertiserDomains if there is
+// no AdvertiserURL.
+//
+// request http request from a web browser
+//
+// returnUrl return URL after the operation completes
+//
+// bid the advert to stop, for example as returned from WinningBid
+//
+// opts override the defaults in the connection for this operation only
+func (c *Connection) NewStopFromBid(
+	request *http.Request,
+	returnUrl string,
+	bid *Bid,
+	opts ...Option) (*Stop, error) {
+	if bid == nil {
+		return nil, fmt.Errorf("bid required")
+	}
+	h := bid.AdvertiserURL
+	if h == "" && len(bid.AdvertiserDomains) > 0 {
+		h = bid.AdvertiserDomains[0]
+	}
+	n, err := NormalizeHost(h)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewStop(request, returnUrl, n, opts...), nil
+}
+
+// NewStopFromNode creates a new stop operation using the default in the
+// connection for the advertiser of the bid in the node. See NewStopFromBid.
+//
+// request http request from a web browser
+//
+// returnUrl return URL after the operation completes
+//
+// node containing the bid to stop, for example as returned from WinningNode
+//
+// advert true if the OWID of the node should also be stopped as the
+// identifier of the advert
+//
+// opts override the defaults in the connection for this operation only
+func (c *Connection) NewStopFromNode(
+	request *http.Request,
+	returnUrl string,
+	node *owid.Node,
+	advert bool,
+	opts ...Option) (*Stop, error) {
+	if node == nil {
+		return nil, fmt.Errorf("node required")
+	}
+	b, err := BidFromNode(node)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.NewStopFromBid(request, returnUrl, b, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if advert {
+		o, err := node.GetOWID()
+		if err != nil {
+			return nil, err
+		}
+		a, err := o.AsBase64()
+		if err != nil {
+			return nil, err
+		}
+		s.Adverts = append(s.Adverts, a)
+	}
+	return s, nil
+}
+
+// NewReset creates a new reset operation using the default in the
+// connection. When the browser returns to the return URL the SWAN cookies
+// stored by the caller should be removed with ClearCookies.
+//
+// request http request from a web browser
+//
+// returnUrl return URL after the operation completes
+//
+// opts override the defaults in the connection for this operation only
+func (c *Connection) NewReset(
+	request *http.Request,
+	returnUrl string,
+	opts ...Option) *Reset {
+	r := Reset{}
+	r.Operation = c.newOperation(opts)
+	r.Request = request
+	r.ReturnUrl = returnUrl
+	return &r
+}
+
 // NewClient creates a new request.
 //
 // request http request from a web browser
@@ -206,6 +392,20 @@ func (c *Connection) NewSWAN() *SWAN {
 	return &s
 }
 
+// String returns the name of the change.
+func (c Change) String() string {
+	switch c {
+	case ChangeNone:
+		return "none"
+	case ChangeSet:
+		return "set"
+	case ChangeClear:
+		return "clear"
+	default:
+		return "unknown"
+	}
+}
+
 // GetURL contacts the SWAN operator domain with the access key and returns a
 // URL string that the web browser should be immediately directed to.
 func (f *Fetch) GetURL() (string, *Error) {
@@ -223,54 +423,123 @@ func (f *Fetch) GetURL() (string, *Error) {
 func (u *Update) SetSWID(swid string) error {
 	var err error
 	u.swid, err = owid.FromBase64(swid)
+	u.clearSWID = false
 	return err
 }
 
 // SWID gets the SWID if previously provided via SetSWID.
 func (u *Update) SWID() *owid.OWID { return u.swid }
 
-// SetEmail turns the email provided into an OWID using the creator.
+// ClearSWID removes the SWID from SWAN when the Update is performed.
+func (u *Update) ClearSWID() {
+	u.swid = nil
+	u.clearSWID = true
+}
+
+// SWIDChange returns how the Update will change the SWID.
+func (u *Update) SWIDChange() Change { return u.change(u.swid, u.clearSWID) }
+
+// SetEmail turns the email provided into an OWID using the creator. If the
+// email is not empty and not valid a *ValidationError is returned. See
+// ValidateEmail.
 //
 // creator register OWID creator for the User Interface Provider
 //
 // email provided by the user
 func (u *Update) SetEmail(creator *owid.Creator, email string) error {
+	if email != "" {
+		err := ValidateEmail(email)
+		if err != nil {
+			return err
+		}
+	}
 	var err error
 	u.email, err = creator.CreateOWIDandSign([]byte(email))
+	u.clearEmail = false
 	return err
 }
 
-// SetEmailFromOWID passed a base 64 encoded OWID as the email.
+// SetEmailFromOWID passed a base 64 encoded OWID as the email. The payload of
+// the OWID is validated in the same way as SetEmail.
 func (u *Update) SetEmailFromOWID(emailOWID string) error {
-	var err error
-	u.email, err = owid.FromBase64(emailOWID)
-	return err
+	o, err := owid.FromBase64(emailOWID)
+	if err != nil {
+		return err
+	}
+	if len(o.Payload) > 0 {
+		err = ValidateEmail(string(o.Payload))
+		if err != nil {
+			return err
+		}
+	}
+	u.email = o
+	u.clearEmail = false
+	return nil
 }
 
 // Email gets the Email if previously provided via SetEmail.
 func (u *Update) Email() *owid.OWID { return u.email }
 
-// SetSalt turns the salt provided into an OWID using the creator.
+// ClearEmail removes the email from SWAN when the Update is performed.
+func (u *Update) ClearEmail() {
+	u.email = nil
+	u.clearEmail = true
+}
+
+// EmailChange returns how the Update will change the email.
+func (u *Update) EmailChange() Change {
+	return u.change(u.email, u.clearEmail)
+}
+
+// SetSalt turns the salt provided into an OWID using the creator. If the salt
+// is not empty and not valid a *ValidationError is returned. See ValidateSalt.
 //
 // creator register OWID creator for the User Interface Provider
 //
 // salt base 64 encoded salt string from salt-js
 func (u *Update) SetSalt(creator *owid.Creator, salt string) error {
+	if salt != "" {
+		err := ValidateSalt(salt)
+		if err != nil {
+			return err
+		}
+	}
 	var err error
 	u.salt, err = creator.CreateOWIDandSign([]byte(salt))
+	u.clearSalt = false
 	return err
 }
 
-// SetSaltFromOWID passed a base 64 encoded OWID as the salt.
+// SetSaltFromOWID passed a base 64 encoded OWID as the salt. The payload of
+// the OWID is validated in the same way as SetSalt.
 func (u *Update) SetSaltFromOWID(saltOWID string) error {
-	var err error
-	u.salt, err = owid.FromBase64(saltOWID)
-	return err
+	o, err := owid.FromBase64(saltOWID)
+	if err != nil {
+		return err
+	}
+	if len(o.Payload) > 0 {
+		err = ValidateSalt(string(o.Payload))
+		if err != nil {
+			return err
+		}
+	}
+	u.salt = o
+	u.clearSalt = false
+	return nil
 }
 
 // Salt gets the Salt if previously provided via SetSalt.
 func (u *Update) Salt() *owid.OWID { return u.salt }
 
+// ClearSalt removes the salt from SWAN when the Update is performed.
+func (u *Update) ClearSalt() {
+	u.salt = nil
+	u.clearSalt = true
+}
+
+// SaltChange returns how the Update will change the salt.
+func (u *Update) SaltChange() Change { return u.change(u.salt, u.clearSalt) }
+
 // SetPref turns the preference flag provided into an OWID using the creator.
 //
 // creator register OWID creator for the User Interface Provider
@@ -280,24 +549,81 @@ func (u *Update) SetPref(creator *owid.Creator, pref bool) error {
 	var err error
 	var s string
 	if pref == true {
-		s = "on"
+		s = prefOn
 	} else {
-		s = "off"
+		s = prefOff
 	}
 	u.pref, err = creator.CreateOWIDandSign([]byte(s))
+	u.clearPref = false
+	return err
+}
+
+// SetPreferences turns the preferences provided into an OWID using the
+// creator. The preferences are written with the latest version of the
+// Preferences payload. Parties that only support the legacy payload should
+// continue to use SetPref.
+//
+// creator register OWID creator for the User Interface Provider
+//
+// prefs the user's choices for each purpose
+func (u *Update) SetPreferences(
+	creator *owid.Creator,
+	prefs *Preferences) error {
+	if prefs == nil {
+		return fmt.Errorf("prefs required")
+	}
+	b, err := prefs.AsByteArray()
+	if err != nil {
+		return err
+	}
+	u.pref, err = creator.CreateOWIDandSign(b)
+	u.clearPref = false
 	return err
 }
 
+// Preferences gets the preferences from the Pref if previously provided via
+// SetPref, SetPreferences or SetPrefFromOWID. Legacy "on" or "off" preferences
+// are returned with all purposes allowed or not allowed.
+func (u *Update) Preferences() (*Preferences, error) {
+	if u.pref == nil {
+		return nil, fmt.Errorf("preferences not set")
+	}
+	return PreferencesFromOWID(u.pref)
+}
+
 // SetPrefFromOWID passed a base 64 encoded OWID as the preference.
 func (u *Update) SetPrefFromOWID(prefOWID string) error {
 	var err error
 	u.pref, err = owid.FromBase64(prefOWID)
+	u.clearPref = false
 	return err
 }
 
 // Pref gets the Pref if previously provided via SetPref.
 func (u *Update) Pref() *owid.OWID { return u.pref }
 
+// ClearPref removes the preferences from SWAN when the Update is performed.
+func (u *Update) ClearPref() {
+	u.pref = nil
+	u.clearPref = true
+}
+
+// PrefChange returns how the Update will change the preferences.
+func (u *Update) PrefChange() Change { return u.change(u.pref, u.clearPref) }
+
+// change returns how the Update will change a field with the value v that has
+// been cleared if c is true. Fields that have not been set are removed unless
+// the Update is a Patch.
+func (u *Update) change(v *owid.OWID, c bool) Change {
+	if v != nil {
+		return ChangeSet
+	}
+	if c || u.Patch == false {
+		return ChangeClear
+	}
+	return ChangeNone
+}
+
 // GetURL contacts the SWAN operator domain with the access key and returns a
 // URL string that the web browser should be directed to.
 func (u *Update) GetURL() (string, *Error) {
@@ -312,30 +638,103 @@ func (u *Update) GetURL() (string, *Error) {
 // GetValues returns the values that can be used to configure a web browser with
 // the information contained in the Update operation. Ensure the access key and
 // other values that are specific to an operation are not included in the
-// resulting values.
+// resulting values. The State is not signed as the party that receives the
+// values signs the State with its own StateSigner.
 func (u *Update) GetValues() (url.Values, error) {
 	q := url.Values{}
 	err := u.setData(&q)
 	if err != nil {
 		return nil, err
 	}
-	q.Del("accessKey") // Known only to this party and must never be shared
-	q.Del("swid")      // Not to be shared with other browsers
-	// Used for home node operations that depend on the specific browser
-	q.Del("remoteAddr")
-	q.Del("X-Forwarded-For")
+	for _, k := range updatePrivateKeys {
+		q.Del(k)
+	}
+	q.Del("state")
+	for _, s := range u.State {
+		q.Add("state", s)
+	}
 	return q, nil
 }
 
+// UpdateFromValues returns a new Update operation using the defaults in the
+// connection from values created by Update.GetValues. Used to relay an Update
+// between two parties. An error is returned if the values contain any of the
+// fields that must never be shared such as the access key, or if any of the
+// values are invalid.
+//
+// c connection with the defaults and the access key of this party
+//
+// request http request from a web browser
+//
+// values from Update.GetValues
+func UpdateFromValues(
+	c *Connection,
+	request *http.Request,
+	values url.Values) (*Update, error) {
+	for k := range values {
+		for _, p := range updatePrivateKeys {
+			if strings.EqualFold(k, p) {
+				return nil, newValidationError(k, "", "must not be shared")
+			}
+		}
+	}
+	u := c.NewUpdate(request, values.Get("returnUrl"))
+	err := u.Operation.setFromValues(values)
+	if err != nil {
+		return nil, err
+	}
+	if values.Has("patch") {
+		u.Patch, err = parseBoolValue(values, "patch")
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = u.setFieldFromValues(values, "pref", u.SetPrefFromOWID, u.ClearPref)
+	if err != nil {
+		return nil, err
+	}
+	err = u.setFieldFromValues(
+		values,
+		"email",
+		u.SetEmailFromOWID,
+		u.ClearEmail)
+	if err != nil {
+		return nil, err
+	}
+	err = u.setFieldFromValues(values, "salt", u.SetSaltFromOWID, u.ClearSalt)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 // GetURL contacts the SWAN operator domain with the access key and returns a
-// URL string that the web browser should be directed to.
+// URL string that the web browser should be directed to. If any of the hosts
+// or adverts are invalid, or the SWAN operator rejects them, the Err member of
+// the error returned is a *StopError.
 func (s *Stop) GetURL() (string, *Error) {
 	q := url.Values{}
 	err := s.setData(&q)
 	if err != nil {
 		return "", &Error{Err: err}
 	}
-	return requestAsString(&s.SWAN, "stop", q)
+	u, se := requestAsString(&s.SWAN, "stop", q)
+	if se != nil && se.StatusCode() >= 400 && se.StatusCode() < 500 {
+		se.Err = newStopErrorFromResponse(se.Err.Error(), s.entries())
+	}
+	return u, se
+}
+
+// GetURL contacts the SWAN operator domain with the access key and returns a
+// URL string that the web browser should be directed to in order to remove
+// all the SWAN data.
+func (r *Reset) GetURL() (string, *Error) {
+	q := url.Values{}
+	err := r.setData(&q)
+	if err != nil {
+		return "", &Error{Err: err}
+	}
+	return requestAsString(&r.SWAN, "reset", q)
 }
 
 // Decrypt returns SWAN key value pairs for the data contained in the encrypted
@@ -497,22 +896,66 @@ func (s *Stop) setData(q *url.Values) error {
 	if err != nil {
 		return err
 	}
-	if s.Host == "" {
-		return fmt.Errorf("host required")
+	var h []string
+	var r StopError
+	for _, v := range s.hosts() {
+		n, err := NormalizeHost(v)
+		if err != nil {
+			r.add(v, err.Error())
+		} else {
+			h = append(h, n)
+		}
+	}
+	for _, v := range s.Adverts {
+		_, err := owid.FromBase64(v)
+		if err != nil {
+			r.add(v, err.Error())
+		}
+	}
+	if len(r.Rejected) > 0 {
+		return &r
+	}
+	if len(h) == 0 && len(s.Adverts) == 0 {
+		return fmt.Errorf("host or advert required")
+	}
+	for _, v := range h {
+		q.Add("host", v)
+	}
+	for _, v := range s.Adverts {
+		q.Add("advert", v)
+	}
+	if s.Unstop {
+		q.Set("unstop", "true")
 	}
-	q.Set("host", s.Host)
 	return nil
 }
 
+// hosts returns the Host and Hosts members as a single array.
+func (s *Stop) hosts() []string {
+	var h []string
+	if s.Host != "" {
+		h = append(h, s.Host)
+	}
+	return append(h, s.Hosts...)
+}
+
+// entries returns all the hosts and adverts in the operation.
+func (s *Stop) entries() []string {
+	return append(s.hosts(), s.Adverts...)
+}
+
+func (r *Reset) setData(q *url.Values) error {
+	return r.Operation.setData(q)
+}
+
+// setData validates the operation before any values are set so that invalid
+// values never reach the SWAN Operator.
 func (o *Operation) setData(q *url.Values) error {
-	err := o.Client.setData(q)
+	err := o.Validate()
 	if err != nil {
 		return err
 	}
-	if o.ReturnUrl == "" {
-		return fmt.Errorf("ReturnURL required")
-	}
-	_, err = url.Parse(o.ReturnUrl)
+	err = o.Client.setData(q)
 	if err != nil {
 		return err
 	}
@@ -544,7 +987,14 @@ func (o *Operation) setData(q *url.Values) error {
 		o.PostMessageOnComplete))
 	q.Set("useHomeNode", fmt.Sprintf("%t", o.UseHomeNode))
 	q.Set("javaScript", fmt.Sprintf("%t", o.JavaScript))
-	for _, s := range o.State {
+	t := o.State
+	if o.StateSigner != nil {
+		t, err = o.StateSigner.SignState(o.State)
+		if err != nil {
+			return err
+		}
+	}
+	for _, s := range t {
 		q.Add("state", s)
 	}
 	return nil
@@ -570,42 +1020,161 @@ func (f *Fetch) setData(q *url.Values) error {
 }
 
 func (u *Update) setData(q *url.Values) error {
-	var s string
 	err := u.Operation.setData(q)
 	if err != nil {
 		return err
 	}
-	if u.swid != nil {
-		s, err = u.swid.AsBase64()
+	if u.Patch {
+		q.Set("patch", "true")
+	}
+	err = u.setField(q, "swid", u.swid, u.clearSWID)
+	if err != nil {
+		return err
+	}
+	err = u.setField(q, "pref", u.pref, u.clearPref)
+	if err != nil {
+		return err
+	}
+	err = u.setField(q, "email", u.email, u.clearEmail)
+	if err != nil {
+		return err
+	}
+	err = u.setField(q, "salt", u.salt, u.clearSalt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// setField sets the value v as a base 64 string against the key k. If the
+// Update is a Patch and the field has been cleared, c is true, then an empty
+// value is set to remove the field. Otherwise fields that have not been set
+// are not included in the values.
+func (u *Update) setField(
+	q *url.Values,
+	k string,
+	v *owid.OWID,
+	c bool) error {
+	if v != nil {
+		s, err := v.AsBase64()
 		if err != nil {
 			return err
 		}
-		q.Set("swid", s)
+		q.Set(k, s)
+	} else if c && u.Patch {
+		q.Set(k, "")
 	}
-	if u.pref != nil {
-		s, err = u.pref.AsBase64()
-		if err != nil {
-			return err
+	return nil
+}
+
+// setFieldFromValues sets the field with the key k from the values using the
+// set function. If the value is empty then the field is cleared with the clear
+// function if the Update is a Patch and otherwise ignored.
+func (u *Update) setFieldFromValues(
+	values url.Values,
+	k string,
+	set func(string) error,
+	clear func()) error {
+	if values.Has(k) == false {
+		return nil
+	}
+	v := values.Get(k)
+	if v == "" {
+		if u.Patch {
+			clear()
 		}
-		q.Set("pref", s)
+		return nil
+	}
+	err := set(v)
+	if err != nil {
+		return newValidationError(k, v, "%s", err)
+	}
+	return nil
+}
+
+// setFromValues sets the members of the operation from the values created by
+// setData. Members that are not present in the values are unchanged.
+func (o *Operation) setFromValues(q url.Values) error {
+	var err error
+	if o.ReturnUrl == "" {
+		return newValidationError("returnUrl", "", "required")
+	}
+	_, err = url.Parse(o.ReturnUrl)
+	if err != nil {
+		return newValidationError("returnUrl", o.ReturnUrl, "%s", err)
 	}
-	if u.email != nil {
-		s, err = u.email.AsBase64()
+	if o.returnURLPolicy != nil {
+		err = o.returnURLPolicy.Check(o.ReturnUrl)
 		if err != nil {
 			return err
 		}
-		q.Set("email", s)
 	}
-	if u.salt != nil {
-		s, err = u.salt.AsBase64()
+	setStringFromValues(q, "accessNode", &o.AccessNode)
+	setStringFromValues(q, "title", &o.Title)
+	setStringFromValues(q, "message", &o.Message)
+	setStringFromValues(q, "progressColor", &o.ProgressColor)
+	setStringFromValues(q, "backgroundColor", &o.BackgroundColor)
+	setStringFromValues(q, "messageColor", &o.MessageColor)
+	if q.Has("nodeCount") {
+		o.NodeCount, err = strconv.Atoi(q.Get("nodeCount"))
 		if err != nil {
-			return err
+			return newValidationError(
+				"nodeCount",
+				q.Get("nodeCount"),
+				"must be a number")
 		}
-		q.Set("salt", s)
+	}
+	b := []struct {
+		k string
+		v *bool
+	}{
+		{"displayUserInterface", &o.DisplayUserInterface},
+		{"postMessageOnComplete", &o.PostMessageOnComplete},
+		{"useHomeNode", &o.UseHomeNode},
+		{"javaScript", &o.JavaScript},
+	}
+	for _, i := range b {
+		if q.Has(i.k) {
+			*i.v, err = parseBoolValue(q, i.k)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if q.Has("state") {
+		o.State = unsignedState(q["state"])
 	}
 	return nil
 }
 
+// unsignedState returns a copy of the state without any signature items so
+// that state signed by another party is not signed again.
+func unsignedState(state []string) []string {
+	s := make([]string, 0, len(state))
+	for _, i := range state {
+		if strings.HasPrefix(i, stateTokenPrefix) == false {
+			s = append(s, i)
+		}
+	}
+	return s
+}
+
+// setStringFromValues sets s to the value of the key k if present.
+func setStringFromValues(q url.Values, k string, s *string) {
+	if q.Has(k) {
+		*s = q.Get(k)
+	}
+}
+
+// parseBoolValue returns the boolean value of the key k.
+func parseBoolValue(q url.Values, k string) (bool, error) {
+	v, err := strconv.ParseBool(q.Get(k))
+	if err != nil {
+		return false, newValidationError(k, q.Get(k), "must be true or false")
+	}
+	return v, nil
+}
+
 // setSWANData uses the creator to turn the value v into an OWID before setting
 // that OWID as a base 64 string in the query values q against the key k.
 // c owid creator for the User Interface Provider
@@ -0,0 +1,234 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SWAN-community/owid-go"
+	"github.com/google/uuid"
+)
+
+// Characters used in place of the masked part of values.
+const diffMask = "***"
+
+// DiffKind is the difference an Update operation will make to a SWAN field.
+type DiffKind byte
+
+// Differences reported by Update.Diff.
+const (
+	DiffUnchanged DiffKind = iota // The field will not change
+	DiffAdded     DiffKind = iota // The field does not exist and will be set
+	DiffChanged   DiffKind = iota // The field will be set to a different value
+	DiffCleared   DiffKind = iota // The field exists and will be removed
+)
+
+// FieldDiff is the difference an Update operation will make to a SWAN field.
+// The values are suitable to display to the user with the personal parts of
+// the SWID, email and salt masked.
+type FieldDiff struct {
+	Field   string   // The name of the field; swid, pref, email or salt
+	Kind    DiffKind // The difference that will be made
+	Current string   // The masked current value, or empty if none
+	New     string   // The masked new value, or empty if none or cleared
+}
+
+// String returns the name of the difference.
+func (k DiffKind) String() string {
+	switch k {
+	case DiffUnchanged:
+		return "unchanged"
+	case DiffAdded:
+		return "added"
+	case DiffChanged:
+		return "changed"
+	case DiffCleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
+}
+
+// Diff compares the Update with the current SWAN data and returns the
+// difference that will be made to each of the swid, pref, email and salt
+// fields. Decrypt does not return the email and salt so the raw data from
+// DecryptRaw is also used. Either can be nil. Values in the pairs are used in
+// preference to the raw values with the same key. Preferences are compared by
+// the choices and policy version so that preferences signed again with the
+// same choices are unchanged.
+//
+// pairs returned from Connection.Decrypt
+//
+// raw returned from Connection.DecryptRaw
+func (u *Update) Diff(
+	pairs []*Pair,
+	raw map[string]interface{}) ([]*FieldDiff, error) {
+	m := make(map[string]*Pair, len(pairs))
+	for _, p := range pairs {
+		m[p.Key] = p
+	}
+	for _, k := range []string{"swid", "pref", "email", "salt"} {
+		if _, ok := m[k]; ok {
+			continue
+		}
+		if v, ok := raw[k].(string); ok {
+			m[k] = &Pair{Key: k, Value: v}
+		}
+	}
+	f := []struct {
+		k string
+		v *owid.OWID
+		c Change
+	}{
+		{"swid", u.swid, u.SWIDChange()},
+		{"pref", u.pref, u.PrefChange()},
+		{"email", u.email, u.EmailChange()},
+		{"salt", u.salt, u.SaltChange()},
+	}
+	d := make([]*FieldDiff, 0, len(f))
+	for _, i := range f {
+		r, err := diffField(i.k, m[i.k], i.v, i.c)
+		if err != nil {
+			return nil, err
+		}
+		d = append(d, r)
+	}
+	return d, nil
+}
+
+// diffField returns the difference for the field k between the current pair
+// p, which may be nil, and the new value v with the change c.
+func diffField(
+	k string,
+	p *Pair,
+	v *owid.OWID,
+	c Change) (*FieldDiff, error) {
+	d := FieldDiff{Field: k}
+	var o []byte
+	if p != nil && p.Value != "" {
+		o = pairPayload(p)
+		d.Current = maskField(k, o)
+	}
+	switch c {
+	case ChangeSet:
+		d.New = maskField(k, v.Payload)
+		if o == nil {
+			d.Kind = DiffAdded
+		} else if equalField(k, o, v.Payload) {
+			d.Kind = DiffUnchanged
+		} else {
+			d.Kind = DiffChanged
+		}
+	case ChangeClear:
+		if o != nil {
+			d.Kind = DiffCleared
+		}
+	case ChangeNone:
+		d.Kind = DiffUnchanged
+		d.New = d.Current
+	default:
+		return nil, fmt.Errorf("change '%d' not supported", c)
+	}
+	return &d, nil
+}
+
+// pairPayload returns the payload of the OWID in the pair, or the value of the
+// pair if it is not an OWID.
+func pairPayload(p *Pair) []byte {
+	o, err := p.AsOWID()
+	if err != nil {
+		return []byte(p.Value)
+	}
+	return o.Payload
+}
+
+// equalField returns true if the payloads a and b of the field k are the same.
+func equalField(k string, a []byte, b []byte) bool {
+	if k == "pref" {
+		x, err := ParsePreferences(a)
+		if err == nil {
+			y, err := ParsePreferences(b)
+			if err == nil {
+				return x.PersonalizedAds == y.PersonalizedAds &&
+					x.Measurement == y.Measurement &&
+					x.ContentPersonalization == y.ContentPersonalization &&
+					x.PolicyVersion == y.PolicyVersion
+			}
+		}
+	}
+	return bytes.Equal(a, b)
+}
+
+// maskField returns the payload of the field k as a string with the personal
+// parts masked.
+func maskField(k string, d []byte) string {
+	switch k {
+	case "swid":
+		s := string(d)
+		u, err := uuid.FromBytes(d)
+		if err == nil {
+			s = u.String()
+		}
+		if len(s) > 8 {
+			return s[:8] + diffMask
+		}
+		return diffMask
+	case "pref":
+		p, err := ParsePreferences(d)
+		if err != nil {
+			return diffMask
+		}
+		return p.summary()
+	case "email":
+		s := string(d)
+		i := strings.LastIndex(s, "@")
+		if i <= 0 {
+			return diffMask
+		}
+		r, _ := utf8.DecodeRuneInString(s)
+		return string(r) + diffMask + s[i:]
+	default:
+		return diffMask
+	}
+}
+
+// summary returns the choices in the preferences as a string.
+func (p *Preferences) summary() string {
+	if p.IsLegacy() {
+		return p.AsLegacyString()
+	}
+	s := fmt.Sprintf(
+		"personalizedAds=%s measurement=%s contentPersonalization=%s",
+		onOff(p.PersonalizedAds),
+		onOff(p.Measurement),
+		onOff(p.ContentPersonalization))
+	if p.PolicyVersion != "" {
+		s += " policyVersion=" + p.PolicyVersion
+	}
+	return s
+}
+
+// onOff returns the legacy preferences string for the flag.
+func onOff(v bool) string {
+	if v {
+		return prefOn
+	}
+	return prefOff
+}
@@ -0,0 +1,112 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUpdateDiff(t *testing.T) {
+	s := uuid.MustParse("0f8fad5b-d9cb-469f-a165-70867728950e")
+	w, err := testOWID("swan.com", s[:]).AsBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	on, err := testOWID("cmp.com", []byte(prefOn)).AsBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPreferences()
+	p.PersonalizedAds = true
+	p.Measurement = true
+	p.ContentPersonalization = true
+	b, err := p.AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := NewConnection(Operation{}).NewUpdate(
+		httptest.NewRequest("GET", "https://cmp.com/", nil),
+		"https://pub.com/swan")
+	u.Patch = true
+	u.pref = testOWID("cmp.com", b)
+	u.email = testOWID("cmp.com", []byte("john@pub.com"))
+	u.ClearSalt()
+	pairs := []*Pair{
+		{Key: "swid", Value: w},
+		{Key: "pref", Value: on}}
+	raw := map[string]interface{}{
+		"pref":  prefOff, // The pairs are used in preference
+		"email": "jane@pub.com",
+		"salt":  "qqo"}
+	testDiff(t, u, pairs, raw, []FieldDiff{
+		{"swid", DiffUnchanged, "0f8fad5b***", "0f8fad5b***"},
+		{"pref", DiffUnchanged, "on", p.summary()},
+		{"email", DiffChanged, "j***@pub.com", "j***@pub.com"},
+		{"salt", DiffCleared, "***", ""}})
+
+	// Without the raw data the email and salt are not known.
+	testDiff(t, u, pairs, nil, []FieldDiff{
+		{"swid", DiffUnchanged, "0f8fad5b***", "0f8fad5b***"},
+		{"pref", DiffUnchanged, "on", p.summary()},
+		{"email", DiffAdded, "", "j***@pub.com"},
+		{"salt", DiffUnchanged, "", ""}})
+
+	u.Patch = false
+	u.swid = testOWID("swan.com", s[:])
+	u.pref = testOWID("cmp.com", []byte(prefOff))
+	u.email = testOWID("cmp.com", []byte("jane@pub.com"))
+	u.salt = testOWID("cmp.com", []byte("qqo"))
+	testDiff(t, u, nil, raw, []FieldDiff{
+		{"swid", DiffAdded, "", "0f8fad5b***"},
+		{"pref", DiffUnchanged, "off", "off"},
+		{"email", DiffUnchanged, "j***@pub.com", "j***@pub.com"},
+		{"salt", DiffUnchanged, "***", "***"}})
+
+	u.swid = nil
+	u.pref = nil
+	u.email = nil
+	u.salt = nil
+	testDiff(t, u, pairs, raw, []FieldDiff{
+		{"swid", DiffCleared, "0f8fad5b***", ""},
+		{"pref", DiffCleared, "on", ""},
+		{"email", DiffCleared, "j***@pub.com", ""},
+		{"salt", DiffCleared, "***", ""}})
+}
+
+func testDiff(
+	t *testing.T,
+	u *Update,
+	pairs []*Pair,
+	raw map[string]interface{},
+	e []FieldDiff) {
+	t.Helper()
+	d, err := u.Diff(pairs, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != len(e) {
+		t.Fatalf("'%d' fields expected '%d'", len(d), len(e))
+	}
+	for i, f := range d {
+		if *f != e[i] {
+			t.Fatalf("'%+v' expected '%+v'", *f, e[i])
+		}
+	}
+}
@@ -18,6 +18,8 @@ package swan
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 
 	"github.com/SWAN-community/owid-go"
 )
@@ -29,29 +31,56 @@ type Empty struct {
 }
 
 // EmptyFromOWID returns an Empty created from the OWID payload.
-func EmptyFromOWID(o *owid.OWID) (*Bid, error) {
-	var b Bid
-	f := bytes.NewBuffer(o.Payload)
-	err := b.setFromBuffer(f)
-	if err != nil {
-		return nil, err
-	}
-	return &b, nil
+func EmptyFromOWID(o *owid.OWID) (*Empty, error) {
+	return Decode[*Empty](o)
+}
+
+// Type returns the byte used to identify an Empty in an OWID payload.
+func (e *Empty) Type() byte { return typeEmpty }
+
+func (e *Empty) fields() []field { return nil }
+
+// Encode writes the Empty to the writer.
+func (e *Empty) Encode(w io.Writer) error {
+	return encode(w, e)
+}
+
+// Decode sets the Empty from the data read from the reader in any of the
+// supported formats. No more than MaxPayloadLength bytes are read.
+func (e *Empty) Decode(r io.Reader) error {
+	*e = Empty{}
+	return decode(r, e)
 }
 
 // AsByteArray returns the Empty as a byte array.
 func (e *Empty) AsByteArray() ([]byte, error) {
 	var f bytes.Buffer
-	e.writeToBuffer(&f)
+	err := e.writeToBuffer(&f)
+	if err != nil {
+		return nil, err
+	}
 	return f.Bytes(), nil
 }
 
 func (e *Empty) writeToBuffer(f *bytes.Buffer) error {
-	e.version = typeVersion
+	e.version = emptyVersion
 	e.structType = typeEmpty
 	return e.base.writeToBuffer(f)
 }
 
 func (e *Empty) setFromBuffer(f *bytes.Buffer) error {
-	return e.base.setFromBuffer(f)
+	err := e.base.setFromBuffer(f)
+	if err != nil {
+		return err
+	}
+	if e.structType != typeEmpty {
+		return fmt.Errorf(
+			"type %s not valid for %s",
+			typeAsString(e.structType),
+			typeAsString(typeEmpty))
+	}
+	if e.version != emptyVersion {
+		return fmt.Errorf("version '%d' not supported", e.version)
+	}
+	return checkTrailing(f)
 }
@@ -0,0 +1,46 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Golden byte vector for an Empty.
+const testEmptyVersion1 = "0103"
+
+func TestEmptyGolden(t *testing.T) {
+	testGolden(t, &Empty{}, testEmptyVersion1)
+	e := &Empty{}
+	e.setHeader(typeEmpty, 1)
+	testGoldenDecode(t, e, testEmptyVersion1)
+}
+
+// TestEmptyVersion checks that unknown versions are rejected so that every
+// Empty decoded can be encoded in all the formats.
+func TestEmptyVersion(t *testing.T) {
+	for _, d := range [][]byte{{0, typeEmpty}, {7, typeEmpty}} {
+		var e Empty
+		if err := e.Decode(bytes.NewReader(d)); err == nil {
+			t.Fatalf("'%v' expected error", d)
+		}
+		if _, err := payloadFromBytes(d); err == nil {
+			t.Fatalf("'%v' expected error", d)
+		}
+	}
+}
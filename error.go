@@ -17,7 +17,10 @@
 package swan
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
 // Error is used to pass back errors from methods that call APIs. If the
@@ -30,7 +33,7 @@ type Error struct {
 
 // StatusCode returns the status code of the response.
 func (e *Error) StatusCode() int {
-	if e.Response != nil {
+	if e != nil && e.Response != nil {
 		return e.Response.StatusCode
 	}
 	return 0
@@ -43,3 +46,107 @@ func (e *Error) Error() string {
 	}
 	return "empty error"
 }
+
+// Unwrap returns the underlying error, or nil if e is nil.
+func (e *Error) Unwrap() error {
+	if e == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// StopError is used when some or all of the hosts or adverts in a Stop
+// operation were rejected either during validation or by the SWAN operator.
+type StopError struct {
+	Rejected []string // The hosts or adverts that were rejected
+	Reasons  []string // The reason for each rejected host or advert
+}
+
+// Error returns the rejected hosts and adverts with the reasons.
+func (e *StopError) Error() string {
+	s := make([]string, len(e.Rejected))
+	for i, r := range e.Rejected {
+		s[i] = fmt.Sprintf("'%s' %s", r, e.Reasons[i])
+	}
+	return "stop rejected " + strings.Join(s, ", ")
+}
+
+func (e *StopError) add(v string, reason string) {
+	e.Rejected = append(e.Rejected, v)
+	e.Reasons = append(e.Reasons, reason)
+}
+
+// newStopErrorFromResponse returns a StopError for the response from the SWAN
+// operator. If the response is a JSON object with the hosts or adverts that
+// were rejected as keys and the reasons as values then only those entries are
+// included. Otherwise all the entries are included with the response as the
+// reason.
+func newStopErrorFromResponse(r string, entries []string) *StopError {
+	var e StopError
+	var m map[string]string
+	if json.Unmarshal([]byte(r), &m) == nil && len(m) > 0 {
+		for _, v := range entries {
+			if reason, ok := m[v]; ok {
+				e.add(v, reason)
+			}
+		}
+	}
+	if len(e.Rejected) == 0 {
+		for _, v := range entries {
+			e.add(v, r)
+		}
+	}
+	return &e
+}
+
+// ValidationError is used when a value provided for a field is invalid. The
+// Field is the name of the form field, or query parameter, that the value was
+// provided for so that a User Interface Provider can show the reason next to
+// the field.
+type ValidationError struct {
+	Field  string // The name of the field, for example email or salt
+	Value  string // The value that was rejected
+	Reason string // Why the value was rejected
+}
+
+// Error returns the field and reason the value was rejected.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s '%s' invalid: %s", e.Field, e.Value, e.Reason)
+}
+
+// newValidationError returns a ValidationError for the field f and value v
+// with the reason formatted from r and a.
+func newValidationError(
+	f string,
+	v string,
+	r string,
+	a ...interface{}) *ValidationError {
+	return &ValidationError{Field: f, Value: v, Reason: fmt.Sprintf(r, a...)}
+}
+
+// ValidationErrors contains all the problems found when validating. Each can be
+// mapped to the field it relates to.
+type ValidationErrors []*ValidationError
+
+// Error returns all the problems separated by semicolons.
+func (e ValidationErrors) Error() string {
+	s := make([]string, len(e))
+	for i, v := range e {
+		s[i] = v.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Field returns the first problem for the field f, or nil if there is none.
+func (e ValidationErrors) Field(f string) *ValidationError {
+	for _, v := range e {
+		if v.Field == f {
+			return v
+		}
+	}
+	return nil
+}
+
+func (e *ValidationErrors) add(err *ValidationError) {
+	*e = append(*e, err)
+}
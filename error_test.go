@@ -0,0 +1,46 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestErrorUnwrapNil checks that a nil *Error, as returned by GetURL when
+// there is no error, can be passed to errors.As.
+func TestErrorUnwrapNil(t *testing.T) {
+	var e *Error
+	var err error = e
+	var s *StopError
+	if errors.As(err, &s) {
+		t.Fatal("nil error matched StopError")
+	}
+}
+
+func TestErrorUnwrapStopError(t *testing.T) {
+	var err error = &Error{Err: newStopErrorFromResponse(
+		`{"bad.com":"invalid"}`,
+		[]string{"good.com", "bad.com"})}
+	var s *StopError
+	if !errors.As(err, &s) {
+		t.Fatal("StopError not found")
+	}
+	if len(s.Rejected) != 1 || s.Rejected[0] != "bad.com" {
+		t.Fatalf("rejected '%v'", s.Rejected)
+	}
+}
@@ -0,0 +1,167 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+	"github.com/google/uuid"
+)
+
+// Keys of the raw SWAN data that contain data about the user. Other keys are
+// options for the storage operation user interface and are not exported.
+var exportRawKeys = []string{"swid", "sid", "pref", "email", "salt", "stop"}
+
+// Key of the SWAN pair that contains the stopped domains.
+const exportStopKey = "stop"
+
+// Export contains all the SWAN data held about a user in a form that can be
+// provided to them in response to a data subject access request.
+type Export struct {
+	Created time.Time      `json:"created"` // When the export was created
+	Values  []*ExportValue `json:"values"`  // The SWAN values
+	Stopped []string       `json:"stopped"` // Stopped domains and adverts
+}
+
+// ExportValue is a single SWAN value. If the value is an OWID the domain of
+// the creator, date it was created and the payload are provided.
+type ExportValue struct {
+	Key     string     `json:"key"`               // Name of the SWAN value
+	Created *time.Time `json:"created,omitempty"` // When the value was stored
+	Expires *time.Time `json:"expires,omitempty"` // When the value expires
+	Domain  string     `json:"domain,omitempty"`  // The OWID creator domain
+	Date    *time.Time `json:"date,omitempty"`    // When the OWID was created
+	Payload string     `json:"payload"`           // The value or OWID payload
+}
+
+// exportHTML is the template used to write the export as HTML.
+var exportHTML = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Your SWAN data</title>
+</head>
+<body>
+<h1>Your SWAN data</h1>
+<p>Created {{ .Created.Format "2006-01-02 15:04:05 MST" }}</p>
+<table>
+<tr><th>Key</th><th>Value</th><th>Created by</th><th>Created</th><th>Expires</th></tr>
+{{ range .Values }}<tr><td>{{ .Key }}</td><td>{{ .Payload }}</td><td>{{ .Domain }}</td><td>{{ if .Date }}{{ .Date.Format "2006-01-02 15:04" }}{{ end }}</td><td>{{ if .Expires }}{{ .Expires.Format "2006-01-02 15:04" }}{{ end }}</td></tr>
+{{ end }}</table>
+<h2>Stopped</h2>
+{{ if .Stopped }}<ul>
+{{ range .Stopped }}<li>{{ . }}</li>
+{{ end }}</ul>{{ else }}<p>None</p>{{ end }}
+</body>
+</html>
+`))
+
+// NewExport combines the results of Decrypt and DecryptRaw into an export.
+// Either can be nil. Values in the pairs are used in preference to the raw
+// values with the same key.
+//
+// pairs returned from Connection.Decrypt
+//
+// raw returned from Connection.DecryptRaw
+func NewExport(pairs []*Pair, raw map[string]interface{}) *Export {
+	e := Export{Created: time.Now().UTC()}
+	k := make(map[string]bool)
+	for _, p := range pairs {
+		if p.Key == exportStopKey {
+			e.Stopped = append(e.Stopped, strings.Fields(p.Value)...)
+		} else {
+			v := newExportValue(p.Key, p.Value)
+			v.Created = timeOrNil(p.Created)
+			v.Expires = timeOrNil(p.Expires)
+			e.Values = append(e.Values, v)
+		}
+		k[p.Key] = true
+	}
+	for _, n := range exportRawKeys {
+		s, ok := raw[n].(string)
+		if ok == false || s == "" || k[n] {
+			continue
+		}
+		if n == exportStopKey {
+			e.Stopped = append(e.Stopped, strings.Fields(s)...)
+		} else {
+			e.Values = append(e.Values, newExportValue(n, s))
+		}
+	}
+	sort.SliceStable(e.Values, func(i, j int) bool {
+		return e.Values[i].Key < e.Values[j].Key
+	})
+	return &e
+}
+
+// AsJSON returns the export as indented JSON.
+func (e *Export) AsJSON() ([]byte, error) {
+	return json.MarshalIndent(e, "", "  ")
+}
+
+// WriteHTML writes the export as an HTML page to the writer.
+func (e *Export) WriteHTML(w io.Writer) error {
+	return exportHTML.Execute(w, e)
+}
+
+// newExportValue returns the value v for the key k decoding OWIDs.
+func newExportValue(k string, v string) *ExportValue {
+	r := ExportValue{Key: k, Payload: v}
+	o, err := owid.FromBase64(v)
+	if err == nil && o.Domain != "" {
+		r.Domain = o.Domain
+		r.Date = timeOrNil(o.Date)
+		r.Payload = exportPayload(k, o)
+	}
+	return &r
+}
+
+// exportPayload returns the payload of the OWID as a readable string. The
+// SWID is a UUID, the SID is hex as returned by ID.SIDAsString and the
+// preferences are decoded. Other payloads are strings.
+func exportPayload(k string, o *owid.OWID) string {
+	switch k {
+	case "swid":
+		u, err := uuid.FromBytes(o.Payload)
+		if err == nil {
+			return u.String()
+		}
+	case "sid":
+		return strings.TrimSpace(o.PayloadAsPrintable())
+	case "pref":
+		p, err := ParsePreferences(o.Payload)
+		if err == nil {
+			return p.summary()
+		}
+	}
+	return o.PayloadAsString()
+}
+
+// timeOrNil returns a pointer to the time, or nil if it is the zero time, so
+// that zero times are omitted from the export.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,160 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testExport returns an export of every SWAN key where the SWID and
+// preferences come from the pairs and the other values from the raw data.
+func testExport(t *testing.T) *Export {
+	t.Helper()
+	s := uuid.MustParse("0f8fad5b-d9cb-469f-a165-70867728950e")
+	w, err := testOWID("swan.com", s[:]).AsBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := testPreferences().AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := testOWID("cmp.com", b).AsBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := testOWID("pub.com", []byte{0x0c, 0xa1, 0xff}).AsBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := time.Date(2022, time.June, 1, 0, 0, 0, 0, time.UTC)
+	pairs := []*Pair{
+		{Key: "swid", Value: w, Expires: e},
+		{Key: "pref", Value: p, Expires: e},
+		{Key: "stop", Value: "a.com b.com"}}
+	raw := map[string]interface{}{
+		"swid":    "ignored", // The pairs are used in preference
+		"stop":    "ignored.com",
+		"sid":     i,
+		"email":   "<jane@pub.com>",
+		"salt":    "qqo",
+		"title":   "Not user data",
+		"message": 42}
+	return NewExport(pairs, raw)
+}
+
+func TestExport(t *testing.T) {
+	x := testExport(t)
+	e := []ExportValue{
+		{Key: "email", Payload: "<jane@pub.com>"},
+		{Key: "pref", Domain: "cmp.com", Payload: testPreferences().summary()},
+		{Key: "salt", Payload: "qqo"},
+		{Key: "sid", Domain: "pub.com", Payload: "0ca1ff"},
+		{Key: "swid",
+			Domain:  "swan.com",
+			Payload: "0f8fad5b-d9cb-469f-a165-70867728950e"}}
+	if len(x.Values) != len(e) {
+		t.Fatalf("'%d' values expected '%d'", len(x.Values), len(e))
+	}
+	for i, v := range x.Values {
+		if v.Key != e[i].Key ||
+			v.Domain != e[i].Domain ||
+			v.Payload != e[i].Payload {
+			t.Fatalf("'%+v' expected '%+v'", *v, e[i])
+		}
+		if (v.Domain != "") != (v.Date != nil && v.Date.Equal(testDate)) {
+			t.Fatalf("'%s' date '%v'", v.Key, v.Date)
+		}
+		if (v.Key == "swid" || v.Key == "pref") != (v.Expires != nil) {
+			t.Fatalf("'%s' expires '%v'", v.Key, v.Expires)
+		}
+	}
+	if strings.Join(x.Stopped, " ") != "a.com b.com" {
+		t.Fatalf("stopped '%v'", x.Stopped)
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	x := testExport(t)
+	b, err := x.AsJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Export
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Created.Equal(x.Created) == false ||
+		len(r.Values) != len(x.Values) ||
+		len(r.Stopped) != len(x.Stopped) {
+		t.Fatalf("'%s' not the export", b)
+	}
+	for i, v := range r.Values {
+		if v.Key != x.Values[i].Key || v.Payload != x.Values[i].Payload {
+			t.Fatalf("'%+v' expected '%+v'", *v, *x.Values[i])
+		}
+	}
+
+	// Times that are not known are omitted.
+	if strings.Count(string(b), `"expires"`) != 2 {
+		t.Fatalf("'%s' expected 2 expiry times", b)
+	}
+}
+
+func TestExportHTML(t *testing.T) {
+	var b bytes.Buffer
+	err := testExport(t).WriteHTML(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := b.String()
+	for _, s := range []string{
+		"<td>&lt;jane@pub.com&gt;</td>",
+		"<td>0ca1ff</td><td>pub.com</td><td>2022-03-01 12:34</td>",
+		"<td>0f8fad5b-d9cb-469f-a165-70867728950e</td><td>swan.com</td>",
+		"<td>qqo</td><td></td><td></td><td></td>",
+		"<td>2022-06-01 00:00</td>",
+		"<li>a.com</li>",
+		"<li>b.com</li>"} {
+		if strings.Contains(h, s) == false {
+			t.Fatalf("'%s' missing from '%s'", s, h)
+		}
+	}
+	for _, s := range []string{"ignored", "Not user data", "<jane"} {
+		if strings.Contains(h, s) {
+			t.Fatalf("'%s' not expected in '%s'", s, h)
+		}
+	}
+}
+
+func TestExportEmpty(t *testing.T) {
+	var b bytes.Buffer
+	err := NewExport(nil, nil).WriteHTML(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "<p>None</p>") == false {
+		t.Fatalf("'%s' expected no stopped domains", b.String())
+	}
+}
@@ -19,6 +19,7 @@ package swan
 import (
 	"bytes"
 	"fmt"
+	"io"
 
 	"github.com/SWAN-community/owid-go"
 )
@@ -33,24 +34,43 @@ type Failed struct {
 
 // FailedFromOWID returns a Failed created from the OWID payload.
 func FailedFromOWID(i *owid.OWID) (*Failed, error) {
-	var n Failed
-	f := bytes.NewBuffer(i.Payload)
-	err := n.setFromBuffer(f)
-	if err != nil {
-		return nil, err
+	return Decode[*Failed](i)
+}
+
+// Type returns the byte used to identify a Failed in an OWID payload.
+func (n *Failed) Type() byte { return typeFailed }
+
+func (n *Failed) fields() []field {
+	return []field{
+		{1, "host", &n.Host},
+		{2, "error", &n.Error},
 	}
-	return &n, nil
+}
+
+// Encode writes the Failed to the writer.
+func (n *Failed) Encode(w io.Writer) error {
+	return encode(w, n)
+}
+
+// Decode sets the Failed from the data read from the reader in any of the
+// supported formats. No more than MaxPayloadLength bytes are read.
+func (n *Failed) Decode(r io.Reader) error {
+	*n = Failed{}
+	return decode(r, n)
 }
 
 // AsByteArray returns the Failed as a byte array.
 func (n *Failed) AsByteArray() ([]byte, error) {
 	var f bytes.Buffer
-	n.writeToBuffer(&f)
+	err := n.writeToBuffer(&f)
+	if err != nil {
+		return nil, err
+	}
 	return f.Bytes(), nil
 }
 
 func (n *Failed) writeToBuffer(f *bytes.Buffer) error {
-	n.version = typeVersion
+	n.version = failedVersion
 	n.structType = typeFailed
 	err := n.base.writeToBuffer(f)
 	if err != nil {
@@ -86,7 +106,10 @@ func (n *Failed) setFromBuffer(f *bytes.Buffer) error {
 		err = fmt.Errorf("Version '%d' not supported", n.base.version)
 		break
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return checkTrailing(f)
 }
 
 func (n *Failed) setFromBufferVersion1(f *bytes.Buffer) error {
@@ -0,0 +1,49 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Golden byte vector for the Failed returned from testFailed.
+const testFailedVersion1 = "" +
+	"01026269646465722e636f6d0074696d656f7574206166746572203130306d73" +
+	"00"
+
+func TestFailedGolden(t *testing.T) {
+	testGolden(t, testFailed(), testFailedVersion1)
+	e := testFailed()
+	e.setHeader(typeFailed, 1)
+	testGoldenDecode(t, e, testFailedVersion1)
+}
+
+// TestFailedInvalid checks that AsByteArray returns an error rather than a
+// payload that can not be decoded.
+func TestFailedInvalid(t *testing.T) {
+	b, err := (&Failed{Host: "a\x00b"}).AsByteArray()
+	if err == nil {
+		t.Fatalf("payload '%x' returned for null character", b)
+	}
+	b, err = (&Failed{Error: strings.Repeat("e", MaxStringLength+1)}).
+		AsByteArray()
+	if !errors.Is(err, ErrTooLong) {
+		t.Fatalf("payload '%x' and error '%v' returned for long string", b, err)
+	}
+}
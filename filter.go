@@ -0,0 +1,168 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"github.com/SWAN-community/owid-go"
+)
+
+// FilterReason is the reason a candidate advert was removed by Filter.
+type FilterReason byte
+
+// Reasons for removing candidate adverts.
+const (
+	// The candidate could not be decoded.
+	FilterInvalid FilterReason = iota
+	// The host of the MediaURL is stopped.
+	FilterMediaStopped FilterReason = iota
+	// The host of the AdvertiserURL or one of the AdvertiserDomains is
+	// stopped.
+	FilterAdvertiserStopped FilterReason = iota
+	// The OWID of the advert is stopped.
+	FilterAdvertStopped FilterReason = iota
+	// The candidate is personalized and the user has not allowed personalized
+	// marketing.
+	FilterNotPersonalized FilterReason = iota
+)
+
+// Candidate is an advert that could be shown to the user.
+type Candidate struct {
+	// The bid for the advert. If nil then Filter sets it to the bid decoded
+	// from the Node.
+	Bid  *Bid
+	Node *owid.Node // The node containing the bid, or nil if not available
+	// True if the advert was selected using the user's personal data.
+	Personalized bool
+}
+
+// Removed is a candidate that was removed by Filter with the reason.
+type Removed struct {
+	Candidate *Candidate
+	Reason    FilterReason
+	// The stopped URL, host or advert, or the error for invalid candidates.
+	Detail string
+}
+
+// String returns a description of the reason.
+func (r FilterReason) String() string {
+	switch r {
+	case FilterInvalid:
+		return "invalid"
+	case FilterMediaStopped:
+		return "media stopped"
+	case FilterAdvertiserStopped:
+		return "advertiser stopped"
+	case FilterAdvertStopped:
+		return "advert stopped"
+	case FilterNotPersonalized:
+		return "not personalized"
+	default:
+		return "unknown"
+	}
+}
+
+// Filter returns the candidates that can be shown to the user of the ID and
+// the candidates that were removed with the reason for each. Candidates are
+// removed if their media or advertiser host is stopped, if the advert OWID is
+// stopped, or if they are personalized and the preferences of the ID do not
+// allow personalized adverts. Personalized adverts are not allowed if the ID
+// is nil or does not contain valid preferences. A nil ID has nothing stopped.
+// The Bid of candidates that only have a Node is set to the bid decoded from
+// the Node.
+func Filter(id *ID, candidates []*Candidate) ([]*Candidate, []*Removed) {
+	var k []*Candidate
+	var r []*Removed
+	l := NewStopList()
+	p := false
+	if id != nil {
+		l, _ = id.StopList()
+		f, err := id.PreferencesAsStruct()
+		p = err == nil && f != nil && f.PersonalizedAds
+	}
+	for _, c := range candidates {
+		m := filterCandidate(l, p, c)
+		if m != nil {
+			r = append(r, m)
+		} else {
+			k = append(k, c)
+		}
+	}
+	return k, r
+}
+
+// FilterBids is the same as Filter for bids. Personalized is used for all the
+// candidates.
+func FilterBids(
+	id *ID,
+	bids []*Bid,
+	personalized bool) ([]*Candidate, []*Removed) {
+	c := make([]*Candidate, 0, len(bids))
+	for _, b := range bids {
+		c = append(c, &Candidate{Bid: b, Personalized: personalized})
+	}
+	return Filter(id, c)
+}
+
+// FilterNodes is the same as Filter for nodes that contain bids, such as the
+// children of a node in a transaction. Personalized is used for all the
+// candidates. Nodes that do not contain a bid are removed as invalid.
+func FilterNodes(
+	id *ID,
+	nodes []*owid.Node,
+	personalized bool) ([]*Candidate, []*Removed) {
+	c := make([]*Candidate, 0, len(nodes))
+	for _, n := range nodes {
+		c = append(c, &Candidate{Node: n, Personalized: personalized})
+	}
+	return Filter(id, c)
+}
+
+// filterCandidate returns the reason the candidate should be removed or nil
+// if it can be kept.
+func filterCandidate(l *StopList, personalized bool, c *Candidate) *Removed {
+	if c.Bid == nil && c.Node != nil {
+		var err error
+		c.Bid, err = BidFromNode(c.Node)
+		if err != nil {
+			return &Removed{c, FilterInvalid, err.Error()}
+		}
+	}
+	if c.Bid == nil {
+		return &Removed{c, FilterInvalid, "bid missing"}
+	}
+	if l.IsStopped(c.Bid.MediaURL) {
+		return &Removed{c, FilterMediaStopped, c.Bid.MediaURL}
+	}
+	if l.IsStopped(c.Bid.AdvertiserURL) {
+		return &Removed{c, FilterAdvertiserStopped, c.Bid.AdvertiserURL}
+	}
+	for _, d := range c.Bid.AdvertiserDomains {
+		if l.IsStopped(d) {
+			return &Removed{c, FilterAdvertiserStopped, d}
+		}
+	}
+	if c.Node != nil {
+		o, err := c.Node.GetOWID()
+		if err == nil && l.IsAdvertStopped(o) {
+			return &Removed{c, FilterAdvertStopped, o.AsString()}
+		}
+	}
+	if c.Personalized && personalized == false {
+		return &Removed{c, FilterNotPersonalized, ""}
+	}
+	return nil
+}
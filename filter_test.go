@@ -0,0 +1,97 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"testing"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// testNode returns a node containing the bid b.
+func testNode(t *testing.T, b *Bid) *owid.Node {
+	t.Helper()
+	p, err := b.AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := testOWID("bidder.com", p).AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &owid.Node{OWID: o}
+}
+
+// TestFilterNilID checks that with no ID nothing is stopped and personalized
+// adverts are removed.
+func TestFilterNilID(t *testing.T) {
+	c := []*Candidate{
+		{Bid: testBid()},
+		{Bid: testBid(), Personalized: true},
+	}
+	k, r := Filter(nil, c)
+	if len(k) != 1 || k[0] != c[0] {
+		t.Fatalf("'%d' kept", len(k))
+	}
+	if len(r) != 1 || r[0].Reason != FilterNotPersonalized {
+		t.Fatalf("'%d' removed", len(r))
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p := NewPreferences()
+	p.PersonalizedAds = true
+	d, err := p.AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &ID{
+		Preferences: testOWID("cmp.com", d),
+		Stopped:     []string{"cdn.stopped.com", ".advertiser.org"},
+	}
+	media := testBid()
+	media.MediaURL = "https://cdn.stopped.com/ad.png"
+	advertiser := testBid()
+	advertiser.AdvertiserURL = "https://www.advertiser.org/"
+	n := testNode(t, testBid())
+	c := []*Candidate{
+		{Bid: testBid(), Personalized: true},
+		{Bid: media},
+		{Bid: advertiser},
+		{Node: n},
+		{Node: &owid.Node{}},
+	}
+	k, r := Filter(i, c)
+	if len(k) != 2 || k[0] != c[0] || k[1] != c[3] {
+		t.Fatalf("'%d' kept", len(k))
+	}
+	if c[3].Bid == nil || c[3].Bid.MediaURL != testBid().MediaURL {
+		t.Fatal("bid not set from node")
+	}
+	e := []FilterReason{
+		FilterMediaStopped,
+		FilterAdvertiserStopped,
+		FilterInvalid}
+	if len(r) != len(e) {
+		t.Fatalf("'%d' removed", len(r))
+	}
+	for j, v := range e {
+		if r[j].Reason != v {
+			t.Fatalf("reason '%s' not '%s'", r[j].Reason, v)
+		}
+	}
+}
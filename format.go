@@ -0,0 +1,232 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// Format of the encoding used for a SWAN data structure in an OWID payload.
+type Format byte
+
+// Encodings supported for SWAN data structures. The SWAN binary encoding
+// starts with the version of the structure. Other encodings start with a
+// marker that is never used as a version.
+const (
+	FormatBinary   Format = iota // SWAN binary encoding, see io.go
+	FormatCBOR     Format = iota // CBOR map as defined in RFC 8949
+	FormatProtobuf Format = iota // Protocol Buffers as defined in swan.proto
+)
+
+// Markers at the start of payloads that are not in the SWAN binary encoding.
+var (
+	// The CBOR self-described tag 55799 from RFC 8949 section 3.4.6.
+	markerCBOR = []byte{0xD9, 0xD9, 0xF7}
+	// A single byte prefix for a Payload message from swan.proto.
+	markerProtobuf = []byte{0xFE}
+)
+
+// field is a member of a SWAN data structure used by the self-describing
+// encodings. Value is a pointer to the member and must be one of *string,
+// *[]byte, *[]string, *uint16, *float64, *bool, *BidFormat, *time.Time,
+// *time.Duration or **owid.OWID.
+type field struct {
+	number int         // Field number in swan.proto
+	name   string      // Key in the CBOR map
+	value  interface{} // Pointer to the member
+}
+
+// Keys in the CBOR map used for the base fields.
+const (
+	cborKeyType    = "type"
+	cborKeyVersion = "version"
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case FormatBinary:
+		return "binary"
+	case FormatCBOR:
+		return "CBOR"
+	case FormatProtobuf:
+		return "Protobuf"
+	default:
+		return "unknown"
+	}
+}
+
+// PayloadFormat returns the format of the SWAN data structure in the payload.
+func PayloadFormat(p []byte) Format {
+	if bytes.HasPrefix(p, markerCBOR) {
+		return FormatCBOR
+	}
+	if bytes.HasPrefix(p, markerProtobuf) {
+		return FormatProtobuf
+	}
+	return FormatBinary
+}
+
+// Marshal returns the SWAN data structure encoded in the format provided for
+// use as an OWID payload. FromOWID detects the format when decoding.
+func Marshal(p Payload, f Format) ([]byte, error) {
+	switch f {
+	case FormatBinary:
+		return p.AsByteArray()
+	case FormatCBOR:
+		return marshalCBOR(p)
+	case FormatProtobuf:
+		return marshalProtobuf(p)
+	default:
+		return nil, fmt.Errorf("format '%d' not supported", f)
+	}
+}
+
+// payloadFromBytes returns the SWAN data structure in the payload using the
+// format detected from the start of the payload.
+func payloadFromBytes(d []byte) (Payload, error) {
+	switch PayloadFormat(d) {
+	case FormatCBOR:
+		return unmarshalCBOR(d[len(markerCBOR):])
+	case FormatProtobuf:
+		return unmarshalProtobuf(d[len(markerProtobuf):])
+	}
+	var b base
+	err := b.setFromBuffer(bytes.NewBuffer(d))
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPayload(b.structType)
+	if err != nil {
+		return nil, err
+	}
+	err = p.setFromBuffer(bytes.NewBuffer(d))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// header returns the type and version to use when encoding the payload in a
+// self-describing format.
+func header(p Payload) (byte, byte) {
+	v := p.Version()
+	if v == 0 {
+		v = latestVersion(p.Type())
+	}
+	return p.Type(), v
+}
+
+// newPayloadWithHeader returns a new instance of the SWAN type t with the
+// version v after checking the version is supported.
+func newPayloadWithHeader(t uint64, v uint64) (Payload, error) {
+	if t > 0xFF {
+		return nil, fmt.Errorf("type '%d' not supported", t)
+	}
+	p, err := newPayload(byte(t))
+	if err != nil {
+		return nil, err
+	}
+	if v < 1 || v > uint64(latestVersion(byte(t))) {
+		return nil, fmt.Errorf(
+			"version '%d' not supported for %s",
+			v,
+			typeAsString(byte(t)))
+	}
+	p.setHeader(byte(t), byte(v))
+	return p, nil
+}
+
+// owidFromBytes returns the OWID in the byte array copying the payload and
+// signature so that the OWID does not alias the byte array.
+func owidFromBytes(d []byte) (*owid.OWID, error) {
+	return readOWID(bytes.NewBuffer(d))
+}
+
+// Range of times in seconds since the Unix epoch that can be encoded. Times
+// outside the years 1 to 9999 can not be converted back to the same time.Time.
+const (
+	minUnixTime = -62135596800 // 0001-01-01T00:00:00Z
+	maxUnixTime = 253402300799 // 9999-12-31T23:59:59Z
+)
+
+// timeFromUnix returns the time for the seconds since the Unix epoch with
+// zero returning the zero time. Returns an error if the time is out of range.
+func timeFromUnix(s int64) (time.Time, error) {
+	if s == 0 {
+		return time.Time{}, nil
+	}
+	if s < minUnixTime || s > maxUnixTime {
+		return time.Time{}, fmt.Errorf("time '%d' out of range", s)
+	}
+	return time.Unix(s, 0).UTC(), nil
+}
+
+// timeAsUnix returns the seconds since the Unix epoch with the zero time
+// returning zero. Returns an error if the time is out of range.
+func timeAsUnix(t time.Time) (int64, error) {
+	if t.IsZero() {
+		return 0, nil
+	}
+	s := t.Unix()
+	if s < minUnixTime || s > maxUnixTime {
+		return 0, fmt.Errorf("time '%s' out of range", t)
+	}
+	return s, nil
+}
+
+// durationAsSeconds returns the whole seconds in the duration. Returns an
+// error if the duration is negative or the seconds do not fit in 32 bits.
+func durationAsSeconds(d time.Duration) (uint32, error) {
+	if d < 0 || d/time.Second > math.MaxUint32 {
+		return 0, fmt.Errorf("duration '%s' out of range", d)
+	}
+	return uint32(d / time.Second), nil
+}
+
+// isEmptyField returns true if the member pointed to by v has the zero value
+// and does not need to be included in self-describing encodings.
+func isEmptyField(v interface{}) bool {
+	switch p := v.(type) {
+	case *string:
+		return *p == ""
+	case *[]byte:
+		return len(*p) == 0
+	case *[]string:
+		return len(*p) == 0
+	case *uint16:
+		return *p == 0
+	case *float64:
+		return *p == 0
+	case *bool:
+		return *p == false
+	case *BidFormat:
+		return *p == BidFormatUnknown
+	case *time.Time:
+		return p.IsZero()
+	case *time.Duration:
+		return *p == 0
+	case **owid.OWID:
+		return *p == nil
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// testPayload is a named SWAN data structure used in table tests.
+type testPayload struct {
+	name string
+	new  func() Payload // Returns a new instance so tests can modify it
+}
+
+// testPayloads returns instances of all the SWAN types with every field set,
+// and with no fields set, for use in table tests.
+func testPayloads() []testPayload {
+	return []testPayload{
+		{"ID", func() Payload { return testID() }},
+		{"ID empty", func() Payload { return &ID{} }},
+		{"ID new", func() Payload {
+			i, _ := NewID()
+			return i
+		}},
+		{"Bid", func() Payload { return testBid() }},
+		{"Bid empty", func() Payload { return &Bid{} }},
+		{"Failed", func() Payload { return testFailed() }},
+		{"Failed empty", func() Payload { return &Failed{} }},
+		{"Empty", func() Payload { return &Empty{} }},
+		{"Preferences", func() Payload { return testPreferences() }},
+		{"Preferences empty", func() Payload { return NewPreferences() }},
+	}
+}
+
+// testBid returns a Bid with every field set to a fixed value.
+func testBid() *Bid {
+	return &Bid{
+		MediaURL:          "https://cdn.advertiser.com/ad.png",
+		AdvertiserURL:     "https://advertiser.com/offer",
+		Price:             1.25,
+		Currency:          "GBP",
+		Width:             728,
+		Height:            90,
+		Format:            BidFormatDisplay,
+		AdvertiserDomains: []string{"advertiser.com", "brand.com"},
+		CampaignID:        "campaign-1",
+		CreativeID:        "creative-2",
+		Expires:           time.Date(2022, time.March, 2, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// testFailed returns a Failed with every field set to a fixed value.
+func testFailed() *Failed {
+	return &Failed{Host: "bidder.com", Error: "timeout after 100ms"}
+}
+
+// testPreferences returns Preferences with every field set to a fixed value.
+func testPreferences() *Preferences {
+	p := NewPreferences()
+	p.PersonalizedAds = true
+	p.ContentPersonalization = true
+	p.PolicyVersion = "2022-01"
+	p.Timestamp = time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+	return p
+}
+
+// withHeader returns p after setting the type and version that are expected
+// after p has been encoded and decoded.
+func withHeader(p Payload) Payload {
+	t, v := header(p)
+	p.setHeader(t, v)
+	return p
+}
+
+// TestFormatConformance checks that every SWAN type decodes to the same
+// structure from all of the supported formats.
+func TestFormatConformance(t *testing.T) {
+	formats := []Format{FormatBinary, FormatCBOR, FormatProtobuf}
+	for _, tp := range testPayloads() {
+		t.Run(tp.name, func(t *testing.T) {
+			e := withHeader(tp.new())
+			for _, f := range formats {
+				b, err := Marshal(e, f)
+				if err != nil {
+					t.Fatalf("%s: %s", f, err)
+				}
+				if PayloadFormat(b) != f {
+					t.Fatalf("%s: detected as %s", f, PayloadFormat(b))
+				}
+
+				// FromOWID must detect the format and return the same
+				// structure.
+				p, err := FromOWID(&owid.OWID{Payload: b})
+				if err != nil {
+					t.Fatalf("%s: %s", f, err)
+				}
+				if !reflect.DeepEqual(p, e) {
+					t.Fatalf("%s: decoded\n%+v\nexpected\n%+v", f, p, e)
+				}
+
+				// Decode on a new instance of the type must do the same.
+				d, err := newPayload(e.Type())
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = d.Decode(bytes.NewReader(b))
+				if err != nil {
+					t.Fatalf("%s: %s", f, err)
+				}
+				if !reflect.DeepEqual(d, e) {
+					t.Fatalf("%s: Decode\n%+v\nexpected\n%+v", f, d, e)
+				}
+			}
+		})
+	}
+}
+
+// TestDecodeWrongType checks that Decode rejects a payload of another type in
+// every format.
+func TestDecodeWrongType(t *testing.T) {
+	for _, f := range []Format{FormatBinary, FormatCBOR, FormatProtobuf} {
+		b, err := Marshal(testFailed(), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var i ID
+		if i.Decode(bytes.NewReader(b)) == nil {
+			t.Fatalf("%s: Failed decoded as ID", f)
+		}
+	}
+}
+
+// TestDurationRange checks that every format rejects durations that are
+// negative or too many seconds to fit in 32 bits and accepts the largest.
+func TestDurationRange(t *testing.T) {
+	m := time.Duration(math.MaxUint32) * time.Second
+	for _, f := range []Format{FormatBinary, FormatCBOR, FormatProtobuf} {
+		for _, d := range []time.Duration{-time.Second, m + time.Second} {
+			i := testID()
+			i.TTL = d
+			_, err := Marshal(i, f)
+			if err == nil ||
+				strings.Contains(err.Error(), "out of range") == false {
+				t.Fatalf("%s: '%s' error '%v'", f, d, err)
+			}
+		}
+		i := withHeader(testID()).(*ID)
+		i.TTL = m
+		b, err := Marshal(i, f)
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+		p, err := FromOWID(&owid.OWID{Payload: b})
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+		if p.(*ID).TTL != m {
+			t.Fatalf("%s: TTL '%s' expected '%s'", f, p.(*ID).TTL, m)
+		}
+	}
+}
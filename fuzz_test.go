@@ -0,0 +1,280 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// All the formats a payload can be encoded in.
+var testFormats = []Format{FormatBinary, FormatCBOR, FormatProtobuf}
+
+// testReencode checks that the payload p, decoded from untrusted data,
+// encodes in every format to data that decodes and encodes again to the same
+// bytes. Formats that can not represent p are skipped.
+func testReencode(t *testing.T, p Payload) {
+	t.Helper()
+	for _, f := range testFormats {
+		b, err := Marshal(p, f)
+		if err != nil {
+			continue
+		}
+		q, err := payloadFromBytes(b)
+		if err != nil {
+			t.Fatalf("%s: data encoded could not be decoded: %s", f, err)
+		}
+		r, err := Marshal(q, f)
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+		if !bytes.Equal(b, r) {
+			t.Fatalf("%s: encoded\n%x\nthen\n%x", f, b, r)
+		}
+	}
+}
+
+// testRoundTrip checks that p encoded in every format decodes to a structure
+// equal to p.
+func testRoundTrip(t *testing.T, p Payload) {
+	t.Helper()
+	e := withHeader(p)
+	for _, f := range testFormats {
+		b, err := Marshal(e, f)
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+		d, err := FromOWID(&owid.OWID{Payload: b})
+		if err != nil {
+			t.Fatalf("%s: %s", f, err)
+		}
+		if !reflect.DeepEqual(d, e) {
+			t.Fatalf("%s: decoded\n%+v\nexpected\n%+v", f, d, e)
+		}
+	}
+}
+
+// validString returns true if s can be written as a SWAN string.
+func validString(s ...string) bool {
+	for _, v := range s {
+		if len(v) > MaxStringLength || strings.IndexByte(v, 0) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// splitList returns the list of strings in s separated by new lines, or nil
+// if s is empty.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// unixTime returns the time for the seconds s and true if s is in the range
+// supported by the encodings.
+func unixTime(s int64) (time.Time, bool) {
+	t, err := timeFromUnix(s)
+	return t, err == nil
+}
+
+func FuzzFromOWID(f *testing.F) {
+	f.Fuzz(func(t *testing.T, d []byte) {
+		p, err := FromOWID(&owid.OWID{Payload: d})
+		if err == nil {
+			testReencode(t, p)
+		}
+	})
+}
+
+func FuzzIDFromOWID(f *testing.F) {
+	f.Fuzz(func(t *testing.T, d []byte) {
+		p, err := IDFromOWID(&owid.OWID{Payload: d})
+		if err == nil {
+			testReencode(t, p)
+		}
+	})
+}
+
+func FuzzBidFromOWID(f *testing.F) {
+	f.Fuzz(func(t *testing.T, d []byte) {
+		p, err := BidFromOWID(&owid.OWID{Payload: d})
+		if err == nil {
+			testReencode(t, p)
+		}
+	})
+}
+
+func FuzzFailedFromOWID(f *testing.F) {
+	f.Fuzz(func(t *testing.T, d []byte) {
+		p, err := FailedFromOWID(&owid.OWID{Payload: d})
+		if err == nil {
+			testReencode(t, p)
+		}
+	})
+}
+
+func FuzzEmptyFromOWID(f *testing.F) {
+	f.Fuzz(func(t *testing.T, d []byte) {
+		p, err := EmptyFromOWID(&owid.OWID{Payload: d})
+		if err == nil {
+			testReencode(t, p)
+		}
+	})
+}
+
+func FuzzPreferencesFromOWID(f *testing.F) {
+	f.Fuzz(func(t *testing.T, d []byte) {
+		p, err := PreferencesFromOWID(&owid.OWID{Payload: d})
+		if err == nil && !p.IsLegacy() {
+			testReencode(t, p)
+		}
+	})
+}
+
+// FuzzIDRoundTrip checks the property that any valid ID encodes and decodes to
+// an equal ID in every format.
+func FuzzIDRoundTrip(f *testing.F) {
+	f.Add(
+		"publisher.com",
+		[]byte{1, 2, 3, 4},
+		[]byte{0xaa},
+		"advertiser.com\nother.com",
+		int64(1646137496),
+		uint32(3600),
+		"https://publisher.com/",
+		"top")
+	f.Fuzz(func(
+		t *testing.T,
+		pubDomain string,
+		uuid []byte,
+		swid []byte,
+		stopped string,
+		created int64,
+		ttl uint32,
+		pageURL string,
+		placement string) {
+		c, ok := unixTime(created)
+		if !ok ||
+			!validString(pubDomain, stopped, pageURL, placement) ||
+			len(uuid) > MaxByteArrayLength ||
+			strings.Contains(stopped, idStoppedSeparator) {
+			t.Skip()
+		}
+		i := &ID{
+			PubDomain: pubDomain,
+			UUID:      append([]byte(nil), uuid...),
+			SWID:      testOWID("swan-operator.org", swid),
+			Stopped:   splitList(stopped),
+			Created:   c,
+			TTL:       time.Duration(ttl) * time.Second,
+			PageURL:   pageURL,
+			Placement: placement,
+		}
+		i.SWID.Payload = append([]byte(nil), swid...)
+		if len(i.Stopped) > MaxArrayLength {
+			t.Skip()
+		}
+		testRoundTrip(t, i)
+	})
+}
+
+// FuzzBidRoundTrip checks the property that any Bid encodes and decodes to an
+// equal Bid in every format.
+func FuzzBidRoundTrip(f *testing.F) {
+	f.Add(
+		"https://cdn.advertiser.com/ad.png",
+		"https://advertiser.com/",
+		1.25,
+		"GBP",
+		uint16(728),
+		uint16(90),
+		byte(BidFormatDisplay),
+		"advertiser.com",
+		"campaign",
+		"creative",
+		int64(1646179200))
+	f.Fuzz(func(
+		t *testing.T,
+		mediaURL string,
+		advertiserURL string,
+		price float64,
+		currency string,
+		width uint16,
+		height uint16,
+		format byte,
+		domains string,
+		campaignID string,
+		creativeID string,
+		expires int64) {
+		e, ok := unixTime(expires)
+		if !ok ||
+			math.IsNaN(price) ||
+			!validString(
+				mediaURL,
+				advertiserURL,
+				currency,
+				domains,
+				campaignID,
+				creativeID) {
+			t.Skip()
+		}
+		b := &Bid{
+			MediaURL:          mediaURL,
+			AdvertiserURL:     advertiserURL,
+			Price:             price,
+			Currency:          currency,
+			Width:             width,
+			Height:            height,
+			Format:            BidFormat(format),
+			AdvertiserDomains: splitList(domains),
+			CampaignID:        campaignID,
+			CreativeID:        creativeID,
+			Expires:           e,
+		}
+		if len(b.AdvertiserDomains) > MaxArrayLength {
+			t.Skip()
+		}
+		testRoundTrip(t, b)
+	})
+}
+
+// FuzzFailedRoundTrip checks the property that any valid Failed encodes and
+// decodes to an equal Failed in every format.
+func FuzzFailedRoundTrip(f *testing.F) {
+	f.Add("bidder.com", "timeout")
+	f.Fuzz(func(t *testing.T, host string, message string) {
+		if !validString(host, message) {
+			t.Skip()
+		}
+		testRoundTrip(t, &Failed{Host: host, Error: message})
+	})
+}
+
+// TestEmptyRoundTrip checks that an Empty encodes and decodes to an Empty in
+// every format.
+func TestEmptyRoundTrip(t *testing.T) {
+	testRoundTrip(t, &Empty{})
+}
@@ -0,0 +1,270 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Values used in the IAB Global Privacy Platform (GPP) string.
+const (
+	gppHeaderType       = 3
+	gppHeaderVersion    = 1
+	gppSectionSeparator = "~"
+	gppSectionUSPrivacy = 6 // uspv1
+	gppSectionUSNat     = 7 // usnat
+	gppSectionUSCA      = 8 // usca
+	gppUSVersion        = 1 // Version of the usnat and usca sections
+)
+
+// Number of 2 bit values in the fields of the US sections that SWAN does not
+// set.
+const (
+	gppUSNatSensitiveData = 12
+	gppUSCASensitiveData  = 9
+	gppUSKnownChild       = 2
+)
+
+// Values of the 2 bit fields in the US sections.
+const (
+	gppNotApplicable = 0
+	gppYes           = 1 // Notice given, opted out or covered
+	gppNo            = 2 // Notice not given, did not opt out or not covered
+)
+
+// GPPSectionIDs returns the ids of the sections in the GPP strings created
+// with the config for use in the gpp_sid field of bid requests.
+func (c *USPrivacyConfig) GPPSectionIDs() ([]int, error) {
+	var s []int
+	if c.IncludeUSPrivacy {
+		s = append(s, gppSectionUSPrivacy)
+	}
+	i, err := gppSectionID(c.Jurisdiction)
+	if err != nil {
+		return nil, err
+	}
+	return append(s, i), nil
+}
+
+// GPPString returns a GPP string containing the section for the jurisdiction
+// of the config and optionally the US Privacy string section.
+func (c *USPrivacyConfig) GPPString(u *USPrivacy) (string, error) {
+	if u == nil {
+		return "", fmt.Errorf("US privacy signals required")
+	}
+	ids, err := c.GPPSectionIDs()
+	if err != nil {
+		return "", err
+	}
+	var w bitWriter
+	w.writeInt(gppHeaderType, 6)
+	w.writeInt(gppHeaderVersion, 6)
+	w.writeInt(len(ids), 12)
+	p := 0
+	for _, i := range ids {
+		w.writeBool(false)
+		w.writeFibonacci(i - p)
+		p = i
+	}
+	h, err := w.asBase64()
+	if err != nil {
+		return "", err
+	}
+	s := []string{h}
+	for _, i := range ids {
+		v, err := c.gppSection(i, u)
+		if err != nil {
+			return "", err
+		}
+		s = append(s, v)
+	}
+	return strings.Join(s, gppSectionSeparator), nil
+}
+
+// ParseGPPString returns the US privacy signals in the section of the GPP
+// string for the jurisdiction. If the section is not present the US Privacy
+// string section is used. An error is returned if neither are present.
+func ParseGPPString(s string, j USJurisdiction) (*USPrivacy, error) {
+	t, err := gppSectionID(j)
+	if err != nil {
+		return nil, err
+	}
+	p := strings.Split(s, gppSectionSeparator)
+	r, err := newBitReader(p[0])
+	if err != nil {
+		return nil, err
+	}
+	if r.readInt(6) != gppHeaderType || r.readInt(6) != gppHeaderVersion {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, fmt.Errorf("GPP header not supported")
+	}
+	ids := r.readFibonacciRanges()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(ids) != len(p)-1 {
+		return nil, fmt.Errorf(
+			"GPP string has '%d' sections but header lists '%d'",
+			len(p)-1,
+			len(ids))
+	}
+	u := -1
+	for n, i := range ids {
+		if i == t {
+			return parseGPPUSSection(j, p[n+1])
+		}
+		if i == gppSectionUSPrivacy {
+			u = n
+		}
+	}
+	if u >= 0 {
+		return ParseUSPrivacyString(p[u+1])
+	}
+	return nil, fmt.Errorf("GPP string does not contain %s or uspv1", j)
+}
+
+// gppSectionID returns the GPP section id for the jurisdiction.
+func gppSectionID(j USJurisdiction) (int, error) {
+	switch j {
+	case USNational:
+		return gppSectionUSNat, nil
+	case USCalifornia:
+		return gppSectionUSCA, nil
+	default:
+		return 0, fmt.Errorf("jurisdiction '%d' not supported", j)
+	}
+}
+
+// gppSection returns the encoded section i for the US privacy signals.
+func (c *USPrivacyConfig) gppSection(i int, u *USPrivacy) (string, error) {
+	if i == gppSectionUSPrivacy {
+		return u.USPrivacyString(), nil
+	}
+	n := gppFlag(u.Notice)
+	var w bitWriter
+	w.writeInt(gppUSVersion, 6)
+	switch i {
+	case gppSectionUSNat:
+		w.writeInt(n, 2) // SharingNotice
+		w.writeInt(n, 2) // SaleOptOutNotice
+		w.writeInt(n, 2) // SharingOptOutNotice
+		w.writeInt(n, 2) // TargetedAdvertisingOptOutNotice
+		w.writeInt(gppNotApplicable, 2)
+		w.writeInt(gppNotApplicable, 2)
+		w.writeInt(gppFlag(u.OptOutSale), 2)
+		w.writeInt(gppFlag(u.OptOutSharing), 2)
+		w.writeInt(gppFlag(u.OptOutTargetedAdvertising), 2)
+		w.writeInt(gppNotApplicable, 2*gppUSNatSensitiveData)
+	case gppSectionUSCA:
+		w.writeInt(n, 2) // SaleOptOutNotice
+		w.writeInt(n, 2) // SharingOptOutNotice
+		w.writeInt(gppNotApplicable, 2)
+		w.writeInt(gppFlag(u.OptOutSale), 2)
+		w.writeInt(gppFlag(
+			u.OptOutSharing || u.OptOutTargetedAdvertising), 2)
+		w.writeInt(gppNotApplicable, 2*gppUSCASensitiveData)
+	default:
+		return "", fmt.Errorf("GPP section '%d' not supported", i)
+	}
+	w.writeInt(gppNotApplicable, 2*gppUSKnownChild)
+	w.writeInt(gppNotApplicable, 2) // PersonalDataConsents
+	w.writeInt(gppFlag(u.LSPACovered), 2)
+	if u.LSPACovered {
+		w.writeInt(gppFlag(c.ServiceProviderMode == false), 2)
+		w.writeInt(gppFlag(c.ServiceProviderMode), 2)
+	} else {
+		w.writeInt(gppNotApplicable, 2)
+		w.writeInt(gppNotApplicable, 2)
+	}
+	return w.asBase64()
+}
+
+// parseGPPUSSection returns the US privacy signals from the usnat or usca
+// section. Sub sections such as the global privacy control are ignored.
+func parseGPPUSSection(j USJurisdiction, s string) (*USPrivacy, error) {
+	r, err := newBitReader(strings.Split(s, ".")[0])
+	if err != nil {
+		return nil, err
+	}
+	v := r.readInt(6)
+	if r.err == nil && v != gppUSVersion {
+		return nil, fmt.Errorf("%s version '%d' not supported", j, v)
+	}
+	var u USPrivacy
+	switch j {
+	case USNational:
+		r.readInt(2) // SharingNotice
+		u.Notice = r.readInt(2) == gppYes
+		r.readInt(2 * 4)
+		u.OptOutSale = r.readInt(2) == gppYes
+		u.OptOutSharing = r.readInt(2) == gppYes
+		u.OptOutTargetedAdvertising = r.readInt(2) == gppYes
+		r.readBits(2 * gppUSNatSensitiveData)
+	case USCalifornia:
+		u.Notice = r.readInt(2) == gppYes
+		r.readInt(2 * 2)
+		u.OptOutSale = r.readInt(2) == gppYes
+		u.OptOutSharing = r.readInt(2) == gppYes
+		u.OptOutTargetedAdvertising = u.OptOutSharing
+		r.readBits(2 * gppUSCASensitiveData)
+	}
+	r.readInt(2 * gppUSKnownChild)
+	r.readInt(2)
+	u.LSPACovered = r.readInt(2) == gppYes
+	r.readInt(2 * 2)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &u, nil
+}
+
+// readFibonacciRanges returns the ids in a GPP Fibonacci range. Each id is
+// an offset from the previous id and the end of a range is an offset from the
+// start.
+func (r *bitReader) readFibonacciRanges() []int {
+	var ids []int
+	n := r.readInt(12)
+	p := 0
+	for i := 0; i < n && r.err == nil; i++ {
+		a := r.readBool()
+		s := p + r.readFibonacci()
+		e := s
+		if a {
+			e = s + r.readFibonacci()
+		}
+		if e-s+len(ids) > MaxArrayLength {
+			r.err = fmt.Errorf("GPP section ids: %w", ErrTooLong)
+			return nil
+		}
+		for j := s; j <= e; j++ {
+			ids = append(ids, j)
+		}
+		p = e
+	}
+	return ids
+}
+
+// gppFlag returns the 2 bit GPP value for the flag.
+func gppFlag(v bool) int {
+	if v {
+		return gppYes
+	}
+	return gppNo
+}
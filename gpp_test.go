@@ -0,0 +1,101 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"testing"
+)
+
+// GPP strings for a user given notice who has not opted out. The usnat string
+// is the same as the example in the IAB GPP documentation.
+const (
+	testGPPUSNat = "DBABLA~BVQqAAAAAgA"
+	testGPPUSCA  = "DBABBg~BUoAAACA"
+	// usnat with the US Privacy section for a user who has opted out.
+	testGPPUSNatOptOut = "DBACTYA~1YYN~BVQVAAAAAgA"
+)
+
+func TestGPPStringUSNat(t *testing.T) {
+	testGPPString(
+		t,
+		&USPrivacyConfig{Jurisdiction: USNational},
+		&USPrivacy{Notice: true},
+		testGPPUSNat,
+		[]int{gppSectionUSNat})
+}
+
+func TestGPPStringUSCA(t *testing.T) {
+	testGPPString(
+		t,
+		&USPrivacyConfig{Jurisdiction: USCalifornia},
+		&USPrivacy{Notice: true},
+		testGPPUSCA,
+		[]int{gppSectionUSCA})
+}
+
+func TestGPPStringUSPrivacy(t *testing.T) {
+	testGPPString(
+		t,
+		&USPrivacyConfig{Jurisdiction: USNational, IncludeUSPrivacy: true},
+		&USPrivacy{
+			Notice:                    true,
+			OptOutSale:                true,
+			OptOutSharing:             true,
+			OptOutTargetedAdvertising: true},
+		testGPPUSNatOptOut,
+		[]int{gppSectionUSPrivacy, gppSectionUSNat})
+
+	// The US Privacy section is used when the jurisdiction is not present.
+	u, err := ParseGPPString(testGPPUSNatOptOut, USCalifornia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.OptOutSale == false || u.Notice == false {
+		t.Fatalf("'%+v' expected opt out with notice", u)
+	}
+	_, err = ParseGPPString(testGPPUSNat, USCalifornia)
+	if err == nil {
+		t.Fatal("expected error for missing section")
+	}
+}
+
+func testGPPString(
+	t *testing.T,
+	c *USPrivacyConfig,
+	u *USPrivacy,
+	e string,
+	ids []int) {
+	s, err := c.GPPString(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != e {
+		t.Fatalf("'%s' expected '%s'", s, e)
+	}
+	i, err := c.GPPSectionIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTCInts(t, "section ids", i, ids)
+	p, err := ParseGPPString(s, c.Jurisdiction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *p != *u {
+		t.Fatalf("'%+v' expected '%+v'", p, u)
+	}
+}
@@ -20,7 +20,9 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"strings"
+	"time"
 
 	"github.com/SWAN-community/owid-go"
 
@@ -41,23 +43,49 @@ type ID struct {
 	SID         *owid.OWID // The Signed In ID as an OWID
 	Preferences *owid.OWID // The privacy preferences as an OWID
 	Stopped     []string   // List of domains or advert IDs that should not be shown
+	// The following fields are only persisted from version 2 onwards.
+	Created   time.Time     // The UTC time when the ID was created
+	TTL       time.Duration // How long the ID can be used for after Created
+	PageURL   string        // The URL of the page the advertisements will appear on
+	Placement string        // The placement on the page for the advertisements
 }
 
 // Returns a new swan.ID with the correct version and type set as well as random
-// data to ensure unique for all time.
+// data to ensure unique for all time. Created is truncated to the second as
+// that is the precision of all the encodings.
 func NewID() (*ID, error) {
 	uuid, err := uuid.New().MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
 	return &ID{
-		base: base{typeVersion, typeID},
-		UUID: uuid,
+		base:    base{idVersion, typeID},
+		UUID:    uuid,
+		Created: time.Now().UTC().Truncate(time.Second),
 	}, nil
 }
 
-// SWIDAsString as a base 64 string.
+// SetVersion sets the version of the encoding to use when the ID is written.
+// Used where the recipient of the ID only supports an earlier version. Fields
+// that are not supported by the version are not written.
+func (o *ID) SetVersion(v byte) error {
+	return o.base.setVersion(typeID, v, idVersion)
+}
+
+// Expires returns the time after which the ID should not be used, or the zero
+// time if the ID does not have a TTL.
+func (o *ID) Expires() time.Time {
+	if o.Created.IsZero() || o.TTL == 0 {
+		return time.Time{}
+	}
+	return o.Created.Add(o.TTL)
+}
+
+// SWIDAsString as a base 64 string. Empty if there is no SWID.
 func (o *ID) SWIDAsString() string {
+	if o.SWID == nil {
+		return ""
+	}
 	u, err := uuid.FromBytes(o.SWID.Payload)
 	if err != nil {
 		return o.SWID.PayloadAsPrintable()
@@ -65,14 +93,34 @@ func (o *ID) SWIDAsString() string {
 	return u.String()
 }
 
-// SIDAsString as a base 64 string.
+// SIDAsString as a base 64 string. Empty if there is no SID.
 func (o *ID) SIDAsString() string {
+	if o.SID == nil {
+		return ""
+	}
 	return o.SID.PayloadAsPrintable()
 }
 
-// PreferencesAsString as a base 64 string.
+// PreferencesAsString returns the legacy "on" or "off" string for legacy
+// preferences, otherwise a summary of the choices in the preferences. Empty if
+// there are no preferences or they are invalid. Use PreferencesAsStruct to get
+// the choices.
 func (o *ID) PreferencesAsString() string {
-	return o.Preferences.PayloadAsString()
+	p, err := o.PreferencesAsStruct()
+	if err != nil || p == nil {
+		return ""
+	}
+	return p.summary()
+}
+
+// PreferencesAsStruct returns the preferences parsed from the Preferences OWID
+// including the legacy "on" or "off" payloads. Nil if there are no
+// preferences.
+func (o *ID) PreferencesAsStruct() (*Preferences, error) {
+	if o.Preferences == nil {
+		return nil, nil
+	}
+	return PreferencesFromOWID(o.Preferences)
 }
 
 // StoppedAsArray returns an array of domains that should not be included in
@@ -81,46 +129,71 @@ func (o *ID) StoppedAsArray() []string {
 	return o.Stopped
 }
 
-// IsStopped returns true if the URL provided is stopped.
+// StopList returns the stop list encoded in the Stopped field. When matching
+// many URLs get the stop list once and use StopList.IsStopped.
+func (o *ID) StopList() (*StopList, error) {
+	return ParseStopList(o.Stopped)
+}
+
+// SetStopList encodes the stop list into the Stopped field.
+func (o *ID) SetStopList(l *StopList) {
+	o.Stopped = l.AsStrings()
+}
+
+// IsStopped returns true if the host of the URL provided, which can also be a
+// host, is stopped. Invalid entries in the Stopped field are ignored.
 func (o *ID) IsStopped(u string) bool {
-	for _, i := range o.StoppedAsArray() {
-		if strings.EqualFold(u, i) {
-			return true
-		}
-	}
-	return false
+	l, _ := o.StopList()
+	return l.IsStopped(u)
 }
 
 // IDFromOWID returns an ID created from the OWID payload.
 func IDFromOWID(i *owid.OWID) (*ID, error) {
-	var o ID
-	buf := bytes.NewBuffer(i.Payload)
-	err := o.setFromBuffer(buf)
-	if err != nil {
-		return nil, err
-	}
-	return &o, nil
+	return Decode[*ID](i)
 }
 
 // IDFromNode returns an ID created from the Node payload.
 func IDFromNode(n *owid.Node) (*ID, error) {
-	var o ID
-	w, err := n.GetOWID()
-	if err != nil {
-		return nil, err
-	}
-	f := bytes.NewBuffer(w.Payload)
-	err = o.setFromBuffer(f)
-	if err != nil {
-		return nil, err
+	return DecodeNode[*ID](n)
+}
+
+// Type returns the byte used to identify an ID in an OWID payload.
+func (o *ID) Type() byte { return typeID }
+
+func (o *ID) fields() []field {
+	return []field{
+		{1, "pubDomain", &o.PubDomain},
+		{2, "uuid", &o.UUID},
+		{3, "swid", &o.SWID},
+		{4, "sid", &o.SID},
+		{5, "preferences", &o.Preferences},
+		{6, "stopped", &o.Stopped},
+		{7, "created", &o.Created},
+		{8, "ttl", &o.TTL},
+		{9, "pageUrl", &o.PageURL},
+		{10, "placement", &o.Placement},
 	}
-	return &o, nil
+}
+
+// Encode writes the ID to the writer.
+func (o *ID) Encode(w io.Writer) error {
+	return encode(w, o)
+}
+
+// Decode sets the ID from the data read from the reader in any of the
+// supported formats. No more than MaxPayloadLength bytes are read.
+func (o *ID) Decode(r io.Reader) error {
+	*o = ID{}
+	return decode(r, o)
 }
 
 // AsByteArray returns the ID as a byte array.
 func (o *ID) AsByteArray() ([]byte, error) {
 	var buf bytes.Buffer
-	o.writeToBuffer(&buf)
+	err := o.writeToBuffer(&buf)
+	if err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -134,13 +207,27 @@ func (o *ID) AsString() (string, error) {
 }
 
 func (o *ID) writeToBuffer(f *bytes.Buffer) error {
-	o.base.version = typeVersion
+	if o.base.version == 0 {
+		o.base.version = idVersion
+	}
 	o.base.structType = typeID
 	err := o.base.writeToBuffer(f)
 	if err != nil {
 		return err
 	}
-	err = writeString(f, o.PubDomain)
+	switch o.base.version {
+	case byte(1):
+		err = o.writeToBufferVersion1(f)
+	case byte(2):
+		err = o.writeToBufferVersion2(f)
+	default:
+		err = fmt.Errorf("version '%d' not supported", o.base.version)
+	}
+	return err
+}
+
+func (o *ID) writeToBufferVersion1(f *bytes.Buffer) error {
+	err := writeString(f, o.PubDomain)
 	if err != nil {
 		return err
 	}
@@ -148,24 +235,17 @@ func (o *ID) writeToBuffer(f *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	err = o.SWID.ToBuffer(f)
+	err = writeOWID(f, o.SWID)
 	if err != nil {
 		return err
 	}
-	err = o.Preferences.ToBuffer(f)
+	err = writeOWID(f, o.Preferences)
 	if err != nil {
 		return err
 	}
-	if o.SID != nil {
-		err = o.SID.ToBuffer(f)
-		if err != nil {
-			return err
-		}
-	} else {
-		err = owid.EmptyToBuffer(f)
-		if err != nil {
-			return err
-		}
+	err = writeOWID(f, o.SID)
+	if err != nil {
+		return err
 	}
 	err = writeString(f, strings.Join(o.Stopped, idStoppedSeparator))
 	if err != nil {
@@ -174,6 +254,30 @@ func (o *ID) writeToBuffer(f *bytes.Buffer) error {
 	return nil
 }
 
+func (o *ID) writeToBufferVersion2(f *bytes.Buffer) error {
+	err := o.writeToBufferVersion1(f)
+	if err != nil {
+		return err
+	}
+	err = writeTime(f, o.Created)
+	if err != nil {
+		return err
+	}
+	err = writeDuration(f, o.TTL)
+	if err != nil {
+		return err
+	}
+	err = writeString(f, o.PageURL)
+	if err != nil {
+		return err
+	}
+	err = writeString(f, o.Placement)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (o *ID) setFromBuffer(f *bytes.Buffer) error {
 	var err error
 	err = o.base.setFromBuffer(f)
@@ -192,13 +296,18 @@ func (o *ID) setFromBuffer(f *bytes.Buffer) error {
 		if err != nil {
 			return err
 		}
+	case byte(2):
+		err = o.setFromBufferVersion2(f)
+		if err != nil {
+			return err
+		}
 	default:
 		err = fmt.Errorf("version '%d' not supported", o.base.version)
 		if err != nil {
 			return err
 		}
 	}
-	return nil
+	return checkTrailing(f)
 }
 
 func (o *ID) setFromBufferVersion1(f *bytes.Buffer) error {
@@ -211,15 +320,15 @@ func (o *ID) setFromBufferVersion1(f *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	o.SWID, err = owid.FromBuffer(f)
+	o.SWID, err = readOWID(f)
 	if err != nil {
 		return err
 	}
-	o.Preferences, err = owid.FromBuffer(f)
+	o.Preferences, err = readOWID(f)
 	if err != nil {
 		return err
 	}
-	o.SID, err = owid.FromBuffer(f)
+	o.SID, err = readOWID(f)
 	if err != nil {
 		return err
 	}
@@ -227,6 +336,34 @@ func (o *ID) setFromBufferVersion1(f *bytes.Buffer) error {
 	if err != nil {
 		return err
 	}
-	o.Stopped = strings.Split(s, idStoppedSeparator)
+	// An empty string is no stopped entries rather than one empty entry so
+	// that all the encodings decode to the same ID.
+	if s != "" {
+		o.Stopped = strings.Split(s, idStoppedSeparator)
+	}
+	return nil
+}
+
+func (o *ID) setFromBufferVersion2(f *bytes.Buffer) error {
+	err := o.setFromBufferVersion1(f)
+	if err != nil {
+		return err
+	}
+	o.Created, err = readTime(f)
+	if err != nil {
+		return err
+	}
+	o.TTL, err = readDuration(f)
+	if err != nil {
+		return err
+	}
+	o.PageURL, err = readString(f)
+	if err != nil {
+		return err
+	}
+	o.Placement, err = readString(f)
+	if err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,196 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// Golden byte vectors for the ID returned from testID. Changes to the binary
+// encoding that alter these break interop with existing SWAN participants.
+const (
+	testIDVersion1 = "" +
+		"01017075626c69736865722e636f6d00100000000102030405060708090a0b0c" +
+		"0d0e0f10037377616e2d6f70657261746f722e6f726700b25e110002000000aa" +
+		"bb000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e" +
+		"1f202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e" +
+		"3f03636d702e636f6d00b25e1100020000006f6e000102030405060708090a0b" +
+		"0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b" +
+		"2c2d2e2f303132333435363738393a3b3c3d3e3f037075626c69736865722e63" +
+		"6f6d00b25e110001000000cc000102030405060708090a0b0c0d0e0f10111213" +
+		"1415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f30313233" +
+		"3435363738393a3b3c3d3e3f616476657274697365722e636f6d0d6f74686572" +
+		"2e636f6d00"
+	testIDVersion2 = "" +
+		"02017075626c69736865722e636f6d00100000000102030405060708090a0b0c" +
+		"0d0e0f10037377616e2d6f70657261746f722e6f726700b25e110002000000aa" +
+		"bb000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e" +
+		"1f202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e" +
+		"3f03636d702e636f6d00b25e1100020000006f6e000102030405060708090a0b" +
+		"0c0d0e0f101112131415161718191a1b1c1d1e1f202122232425262728292a2b" +
+		"2c2d2e2f303132333435363738393a3b3c3d3e3f037075626c69736865722e63" +
+		"6f6d00b25e110001000000cc000102030405060708090a0b0c0d0e0f10111213" +
+		"1415161718191a1b1c1d1e1f202122232425262728292a2b2c2d2e2f30313233" +
+		"3435363738393a3b3c3d3e3f616476657274697365722e636f6d0d6f74686572" +
+		"2e636f6d00f0121e620000000000a7760068747470733a2f2f7075626c697368" +
+		"65722e636f6d2f6e6577732f61727469636c6500746f702d62616e6e657200"
+)
+
+// testDate is the date used for all the test OWIDs. OWIDs store the date to
+// the nearest minute.
+var testDate = time.Date(2022, time.March, 1, 12, 34, 0, 0, time.UTC)
+
+// testOWID returns an OWID with a fixed date and signature containing the
+// payload p so that encodings that include it are repeatable.
+func testOWID(domain string, p []byte) *owid.OWID {
+	s := make([]byte, 64)
+	for i := range s {
+		s[i] = byte(i)
+	}
+	return &owid.OWID{
+		Version:   3,
+		Domain:    domain,
+		Date:      testDate,
+		Payload:   p,
+		Signature: s,
+	}
+}
+
+// testID returns an ID with every field set to a fixed value.
+func testID() *ID {
+	return &ID{
+		PubDomain: "publisher.com",
+		UUID: []byte{
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+			0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		SWID:        testOWID("swan-operator.org", []byte{0xaa, 0xbb}),
+		SID:         testOWID("publisher.com", []byte{0xcc}),
+		Preferences: testOWID("cmp.com", []byte("on")),
+		Stopped:     []string{"advertiser.com", "other.com"},
+		Created:     time.Date(2022, time.March, 1, 12, 34, 56, 0, time.UTC),
+		TTL:         90 * 24 * time.Hour,
+		PageURL:     "https://publisher.com/news/article",
+		Placement:   "top-banner",
+	}
+}
+
+func TestIDGoldenVersion1(t *testing.T) {
+	i := testID()
+	err := i.SetVersion(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGolden(t, i, testIDVersion1)
+
+	// Only the fields in version 1 are expected when decoding.
+	e := testID()
+	e.setHeader(typeID, 1)
+	e.Created = time.Time{}
+	e.TTL = 0
+	e.PageURL = ""
+	e.Placement = ""
+	testGoldenDecode(t, e, testIDVersion1)
+}
+
+func TestIDGoldenVersion2(t *testing.T) {
+	i := testID()
+	testGolden(t, i, testIDVersion2)
+	e := testID()
+	e.setHeader(typeID, 2)
+	testGoldenDecode(t, e, testIDVersion2)
+}
+
+func TestNewIDCreatedRoundTrip(t *testing.T) {
+	i, err := NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := i.AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := IDFromOWID(&owid.OWID{Payload: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Created.Equal(i.Created) {
+		t.Fatalf("created '%s' expected '%s'", d.Created, i.Created)
+	}
+}
+
+func TestIDPreferencesAsString(t *testing.T) {
+	i := testID()
+	if s := i.PreferencesAsString(); s != "on" {
+		t.Fatalf("legacy '%s' expected 'on'", s)
+	}
+	b, err := testPreferences().AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.Preferences = testOWID("cmp.com", b)
+	e := "personalizedAds=on measurement=off contentPersonalization=on " +
+		"policyVersion=2022-01"
+	if s := i.PreferencesAsString(); s != e {
+		t.Fatalf("'%s' expected '%s'", s, e)
+	}
+	i.Preferences = nil
+	if s := i.PreferencesAsString(); s != "" {
+		t.Fatalf("'%s' expected empty", s)
+	}
+}
+
+// testGolden checks that the binary encoding of p is the golden hex string g.
+func testGolden(t *testing.T, p Payload, g string) {
+	t.Helper()
+	b, err := p.AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := hex.EncodeToString(b); h != g {
+		t.Fatalf("encoded\n%s\nexpected\n%s", h, g)
+	}
+	var w bytes.Buffer
+	err = p.Encode(&w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), b) {
+		t.Fatal("Encode and AsByteArray differ")
+	}
+}
+
+// testGoldenDecode checks that the golden hex string g decodes to e.
+func testGoldenDecode(t *testing.T, e Payload, g string) {
+	t.Helper()
+	b, err := hex.DecodeString(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := FromOWID(&owid.OWID{Payload: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, e) {
+		t.Fatalf("decoded\n%+v\nexpected\n%+v", p, e)
+	}
+}
@@ -19,13 +19,67 @@ package swan
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// Limits applied when reading SWAN data structures from OWID payloads which
+// may have been provided by untrusted parties. Values larger than these limits
+// are rejected before any memory is allocated for them.
+var (
+	// MaxStringLength is the maximum number of bytes in a string excluding the
+	// null terminator.
+	MaxStringLength = 16384
+	// MaxByteArrayLength is the maximum number of bytes in a byte array.
+	MaxByteArrayLength = 4096
+	// MaxArrayLength is the maximum number of items in an array of values.
+	MaxArrayLength = 1024
+	// MaxPayloadLength is the maximum number of bytes read from an io.Reader
+	// when decoding a SWAN data structure.
+	MaxPayloadLength = 65536
 )
 
+var (
+	// ErrShortRead is returned when the data ends before the value being read.
+	ErrShortRead = errors.New("short read")
+	// ErrTooLong is returned when a value exceeds the configured maximum.
+	ErrTooLong = errors.New("value too long")
+	// ErrTrailingData is returned when bytes remain after a SWAN data
+	// structure has been read.
+	ErrTrailingData = errors.New("unexpected trailing data")
+)
+
+// next returns the next l bytes from the buffer or an error if there are not
+// enough bytes remaining. The bytes returned alias the buffer.
+func next(b *bytes.Buffer, l int, t string) ([]byte, error) {
+	d := b.Next(l)
+	if len(d) != l {
+		return nil, fmt.Errorf(
+			"'%d' bytes incorrect for %s: %w",
+			len(d),
+			t,
+			ErrShortRead)
+	}
+	return d, nil
+}
+
+// checkTrailing returns an error if there are any unread bytes in the buffer.
+func checkTrailing(b *bytes.Buffer) error {
+	if b.Len() != 0 {
+		return fmt.Errorf("'%d' bytes: %w", b.Len(), ErrTrailingData)
+	}
+	return nil
+}
+
 func readByte(b *bytes.Buffer) (byte, error) {
-	d := b.Next(1)
-	if len(d) != 1 {
-		return 0, fmt.Errorf("'%d' bytes incorrect for Byte", len(d))
+	d, err := next(b, 1, "Byte")
+	if err != nil {
+		return 0, err
 	}
 	return d[0], nil
 }
@@ -34,10 +88,32 @@ func writeByte(b *bytes.Buffer, i byte) error {
 	return b.WriteByte(i)
 }
 
+func readBool(b *bytes.Buffer) (bool, error) {
+	d, err := readByte(b)
+	if err != nil {
+		return false, err
+	}
+	switch d {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("bool '%d' invalid", d)
+	}
+}
+
+func writeBool(b *bytes.Buffer, v bool) error {
+	if v {
+		return b.WriteByte(1)
+	}
+	return b.WriteByte(0)
+}
+
 func readUint16(b *bytes.Buffer) (uint16, error) {
-	d := b.Next(2)
-	if len(d) != 2 {
-		return 0, fmt.Errorf("'%d' bytes incorrect for Uint16", len(d))
+	d, err := next(b, 2, "Uint16")
+	if err != nil {
+		return 0, err
 	}
 	return binary.LittleEndian.Uint16(d), nil
 }
@@ -58,9 +134,9 @@ func writeUint16(b *bytes.Buffer, i uint16) error {
 }
 
 func readUint32(b *bytes.Buffer) (uint32, error) {
-	d := b.Next(4)
-	if len(d) != 4 {
-		return 0, fmt.Errorf("'%d' bytes incorrect for Uint32", len(d))
+	d, err := next(b, 4, "Uint32")
+	if err != nil {
+		return 0, err
 	}
 	return binary.LittleEndian.Uint32(d), nil
 }
@@ -80,15 +156,159 @@ func writeUint32(b *bytes.Buffer, i uint32) error {
 	return err
 }
 
+func readUint64(b *bytes.Buffer) (uint64, error) {
+	d, err := next(b, 8, "Uint64")
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(d), nil
+}
+
+func writeUint64(b *bytes.Buffer, i uint64) error {
+	v := make([]byte, 8)
+	binary.LittleEndian.PutUint64(v, i)
+	l, err := b.Write(v)
+	if err == nil {
+		if l != len(v) {
+			return fmt.Errorf(
+				"Mismatched lengths '%d' and '%d'",
+				l,
+				len(v))
+		}
+	}
+	return err
+}
+
+func readFloat64(b *bytes.Buffer) (float64, error) {
+	i, err := readUint64(b)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(i), nil
+}
+
+func writeFloat64(b *bytes.Buffer, v float64) error {
+	return writeUint64(b, math.Float64bits(v))
+}
+
+// readStrings reads an array of strings preceded by the number of strings. An
+// empty array is returned as nil.
+func readStrings(b *bytes.Buffer) ([]string, error) {
+	l, err := readUint16(b)
+	if err != nil {
+		return nil, err
+	}
+	if l == 0 {
+		return nil, nil
+	}
+	if int(l) > MaxArrayLength {
+		return nil, fmt.Errorf(
+			"'%d' strings exceeds '%d': %w",
+			l,
+			MaxArrayLength,
+			ErrTooLong)
+	}
+	s := make([]string, 0, l)
+	for i := uint16(0); i < l; i++ {
+		v, err := readString(b)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+func writeStrings(b *bytes.Buffer, s []string) error {
+	if len(s) > MaxArrayLength {
+		return fmt.Errorf(
+			"'%d' strings exceeds '%d': %w",
+			len(s),
+			MaxArrayLength,
+			ErrTooLong)
+	}
+	err := writeUint16(b, uint16(len(s)))
+	if err != nil {
+		return err
+	}
+	for _, v := range s {
+		err = writeString(b, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTime reads a time stored as the number of seconds since the Unix epoch
+// in UTC. Zero is used for the zero time.
+func readTime(b *bytes.Buffer) (time.Time, error) {
+	i, err := readUint64(b)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return timeFromUnix(int64(i))
+}
+
+func writeTime(b *bytes.Buffer, t time.Time) error {
+	s, err := timeAsUnix(t)
+	if err != nil {
+		return err
+	}
+	return writeUint64(b, uint64(s))
+}
+
+// readDuration reads a duration stored as a whole number of seconds.
+func readDuration(b *bytes.Buffer) (time.Duration, error) {
+	i, err := readUint32(b)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(i) * time.Second, nil
+}
+
+func writeDuration(b *bytes.Buffer, d time.Duration) error {
+	s, err := durationAsSeconds(d)
+	if err != nil {
+		return err
+	}
+	return writeUint32(b, s)
+}
+
+// readByteArray reads a byte array preceded by its length. The array returned
+// is a copy and does not alias the buffer. An empty array is returned as nil.
 func readByteArray(b *bytes.Buffer) ([]byte, error) {
 	l, err := readUint32(b)
 	if err != nil {
 		return nil, err
 	}
-	return b.Next(int(l)), err
+	if l > uint32(MaxByteArrayLength) {
+		return nil, fmt.Errorf(
+			"'%d' bytes exceeds '%d' for ByteArray: %w",
+			l,
+			MaxByteArrayLength,
+			ErrTooLong)
+	}
+	d, err := next(b, int(l), "ByteArray")
+	if err != nil {
+		return nil, err
+	}
+	if l == 0 {
+		return nil, nil
+	}
+	v := make([]byte, l)
+	copy(v, d)
+	return v, nil
 }
 
 func writeByteArray(b *bytes.Buffer, v []byte) error {
+	if len(v) > MaxByteArrayLength {
+		return fmt.Errorf(
+			"'%d' bytes exceeds '%d' for ByteArray: %w",
+			len(v),
+			MaxByteArrayLength,
+			ErrTooLong)
+	}
 	err := writeUint32(b, uint32(len(v)))
 	if err != nil {
 		return err
@@ -105,15 +325,39 @@ func writeByteArray(b *bytes.Buffer, v []byte) error {
 	return err
 }
 
+// readString reads a null terminated string. Only the first MaxStringLength
+// bytes are searched for the terminator.
 func readString(b *bytes.Buffer) (string, error) {
-	s, err := b.ReadBytes(0)
-	if err == nil {
-		return string(s[0 : len(s)-1]), err
+	d := b.Bytes()
+	if len(d) > MaxStringLength+1 {
+		d = d[:MaxStringLength+1]
+	}
+	i := bytes.IndexByte(d, 0)
+	if i < 0 {
+		if len(d) > MaxStringLength {
+			return "", fmt.Errorf(
+				"string exceeds '%d' bytes: %w",
+				MaxStringLength,
+				ErrTooLong)
+		}
+		return "", fmt.Errorf("string not terminated: %w", ErrShortRead)
 	}
-	return "", err
+	s := string(d[:i])
+	b.Next(i + 1)
+	return s, nil
 }
 
 func writeString(b *bytes.Buffer, s string) error {
+	if len(s) > MaxStringLength {
+		return fmt.Errorf(
+			"string of '%d' bytes exceeds '%d': %w",
+			len(s),
+			MaxStringLength,
+			ErrTooLong)
+	}
+	if strings.IndexByte(s, 0) >= 0 {
+		return fmt.Errorf("string must not contain null characters")
+	}
 	l, err := b.WriteString(s)
 	if err == nil {
 
@@ -131,3 +375,34 @@ func writeString(b *bytes.Buffer, s string) error {
 	}
 	return err
 }
+
+// readOWID reads an OWID from the buffer copying the payload and signature so
+// that the OWID does not alias the buffer. Returns nil if the empty OWID
+// marker was written. The OWID must encode to the same bytes that were read
+// as owid.FromBuffer does not report short reads or dates that overflow.
+func readOWID(b *bytes.Buffer) (*owid.OWID, error) {
+	d := b.Bytes()
+	o, err := owid.FromBuffer(b)
+	if err != nil {
+		return nil, err
+	}
+	if o.Version == 0 {
+		return nil, nil
+	}
+	e, err := o.AsByteArray()
+	if err != nil || !bytes.Equal(e, d[:len(d)-b.Len()]) {
+		return nil, fmt.Errorf("OWID invalid")
+	}
+	o.Payload = append([]byte(nil), o.Payload...)
+	o.Signature = append([]byte(nil), o.Signature...)
+	return o, nil
+}
+
+// writeOWID writes the OWID to the buffer, or the empty OWID marker if the
+// OWID is nil.
+func writeOWID(b *bytes.Buffer, o *owid.OWID) error {
+	if o == nil {
+		return owid.EmptyToBuffer(b)
+	}
+	return o.ToBuffer(b)
+}
@@ -0,0 +1,176 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+func TestIOPrimitivesRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	tm := time.Date(2022, time.March, 1, 12, 34, 56, 0, time.UTC)
+	for _, err := range []error{
+		writeByte(&b, 0x7f),
+		writeBool(&b, true),
+		writeUint16(&b, math.MaxUint16),
+		writeUint32(&b, math.MaxUint32),
+		writeUint64(&b, math.MaxUint64),
+		writeFloat64(&b, -1.5),
+		writeString(&b, "swan"),
+		writeStrings(&b, []string{"a", "", "c"}),
+		writeTime(&b, tm),
+		writeTime(&b, time.Time{}),
+		writeDuration(&b, time.Hour),
+		writeByteArray(&b, []byte{1, 2, 3}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(ok bool, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("value read does not match value written")
+		}
+	}
+	y, err := readByte(&b)
+	check(y == 0x7f, err)
+	o, err := readBool(&b)
+	check(o, err)
+	u16, err := readUint16(&b)
+	check(u16 == math.MaxUint16, err)
+	u32, err := readUint32(&b)
+	check(u32 == math.MaxUint32, err)
+	u64, err := readUint64(&b)
+	check(u64 == math.MaxUint64, err)
+	f, err := readFloat64(&b)
+	check(f == -1.5, err)
+	s, err := readString(&b)
+	check(s == "swan", err)
+	a, err := readStrings(&b)
+	check(len(a) == 3 && a[0] == "a" && a[1] == "" && a[2] == "c", err)
+	r, err := readTime(&b)
+	check(r.Equal(tm), err)
+	r, err = readTime(&b)
+	check(r.IsZero(), err)
+	d, err := readDuration(&b)
+	check(d == time.Hour, err)
+	v, err := readByteArray(&b)
+	check(bytes.Equal(v, []byte{1, 2, 3}), err)
+	check(true, checkTrailing(&b))
+}
+
+func TestIOReadErrors(t *testing.T) {
+	tooMany := []byte{0, 0}
+	tooMany[0] = byte((MaxArrayLength + 1) & 0xff)
+	tooMany[1] = byte((MaxArrayLength + 1) >> 8)
+	for _, c := range []struct {
+		name string
+		data []byte
+		read func(b *bytes.Buffer) error
+		err  error
+	}{
+		{"uint32 short", []byte{1, 2, 3}, func(b *bytes.Buffer) error {
+			_, err := readUint32(b)
+			return err
+		}, ErrShortRead},
+		{"string not terminated", []byte("swan"),
+			func(b *bytes.Buffer) error {
+				_, err := readString(b)
+				return err
+			}, ErrShortRead},
+		{"string too long",
+			[]byte(strings.Repeat("s", MaxStringLength+1) + "\x00"),
+			func(b *bytes.Buffer) error {
+				_, err := readString(b)
+				return err
+			}, ErrTooLong},
+		{"byte array short", []byte{4, 0, 0, 0, 1, 2},
+			func(b *bytes.Buffer) error {
+				_, err := readByteArray(b)
+				return err
+			}, ErrShortRead},
+		{"byte array too long", []byte{0xff, 0xff, 0xff, 0xff},
+			func(b *bytes.Buffer) error {
+				_, err := readByteArray(b)
+				return err
+			}, ErrTooLong},
+		{"strings too many", tooMany, func(b *bytes.Buffer) error {
+			_, err := readStrings(b)
+			return err
+		}, ErrTooLong},
+		{"time out of range", []byte{0, 0, 0, 0, 0, 0, 0, 0x30},
+			func(b *bytes.Buffer) error {
+				_, err := readTime(b)
+				return err
+			}, nil},
+		{"bool invalid", []byte{2}, func(b *bytes.Buffer) error {
+			_, err := readBool(b)
+			return err
+		}, nil},
+	} {
+		err := c.read(bytes.NewBuffer(c.data))
+		if err == nil {
+			t.Fatalf("%s: no error", c.name)
+		}
+		if c.err != nil && !errors.Is(err, c.err) {
+			t.Fatalf("%s: error '%s' not '%s'", c.name, err, c.err)
+		}
+	}
+}
+
+// TestIOByteArrayCopy checks the byte array read does not alias the buffer.
+func TestIOByteArrayCopy(t *testing.T) {
+	d := []byte{2, 0, 0, 0, 1, 2}
+	v, err := readByteArray(bytes.NewBuffer(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d[4] = 9
+	if v[0] != 1 {
+		t.Fatal("byte array aliases the buffer")
+	}
+}
+
+// TestIOTrailingData checks that payloads with bytes after the SWAN data
+// structure are rejected.
+func TestIOTrailingData(t *testing.T) {
+	for _, p := range []Payload{testID(), testBid(), testFailed(), &Empty{}} {
+		b, err := p.AsByteArray()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = FromOWID(&owid.OWID{Payload: append(b, 0)})
+		if !errors.Is(err, ErrTrailingData) {
+			t.Fatalf(
+				"%s: error '%v' not '%s'",
+				typeAsString(p.Type()),
+				err,
+				ErrTrailingData)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxNodeCount is the largest NodeCount that Operation.Validate allows.
+var MaxNodeCount = 100
+
+// Number, percentage, angle or none in a CSS colour function.
+const cssNumber = `(?:[+-]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][+-]?\d+)?` +
+	`(?:%|deg|rad|grad|turn)?|none)`
+
+// Separator between the components of a CSS colour function.
+const cssSeparator = `(?:\s*,\s*|\s+)`
+
+// Regular expressions for CSS colours in hex or functional notation.
+var (
+	cssHexRegex = regexp.MustCompile(
+		`^#(?:[0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	cssFunctionRegex = regexp.MustCompile(
+		`^(?i:rgba?|hsla?|hwb|lab|lch|oklab|oklch)\(\s*` +
+			cssNumber + cssSeparator + cssNumber + cssSeparator + cssNumber +
+			`(?:\s*[,/]\s*` + cssNumber + `)?\s*\)$`)
+)
+
+// CSS named colours including the keywords transparent and currentcolor.
+var cssNamedColors = map[string]bool{
+	"aliceblue": true, "antiquewhite": true, "aqua": true,
+	"aquamarine": true, "azure": true, "beige": true, "bisque": true,
+	"black": true, "blanchedalmond": true, "blue": true, "blueviolet": true,
+	"brown": true, "burlywood": true, "cadetblue": true, "chartreuse": true,
+	"chocolate": true, "coral": true, "cornflowerblue": true,
+	"cornsilk": true, "crimson": true, "cyan": true, "darkblue": true,
+	"darkcyan": true, "darkgoldenrod": true, "darkgray": true,
+	"darkgreen": true, "darkgrey": true, "darkkhaki": true,
+	"darkmagenta": true, "darkolivegreen": true, "darkorange": true,
+	"darkorchid": true, "darkred": true, "darksalmon": true,
+	"darkseagreen": true, "darkslateblue": true, "darkslategray": true,
+	"darkslategrey": true, "darkturquoise": true, "darkviolet": true,
+	"deeppink": true, "deepskyblue": true, "dimgray": true, "dimgrey": true,
+	"dodgerblue": true, "firebrick": true, "floralwhite": true,
+	"forestgreen": true, "fuchsia": true, "gainsboro": true,
+	"ghostwhite": true, "gold": true, "goldenrod": true, "gray": true,
+	"green": true, "greenyellow": true, "grey": true, "honeydew": true,
+	"hotpink": true, "indianred": true, "indigo": true, "ivory": true,
+	"khaki": true, "lavender": true, "lavenderblush": true,
+	"lawngreen": true, "lemonchiffon": true, "lightblue": true,
+	"lightcoral": true, "lightcyan": true, "lightgoldenrodyellow": true,
+	"lightgray": true, "lightgreen": true, "lightgrey": true,
+	"lightpink": true, "lightsalmon": true, "lightseagreen": true,
+	"lightskyblue": true, "lightslategray": true, "lightslategrey": true,
+	"lightsteelblue": true, "lightyellow": true, "lime": true,
+	"limegreen": true, "linen": true, "magenta": true, "maroon": true,
+	"mediumaquamarine": true, "mediumblue": true, "mediumorchid": true,
+	"mediumpurple": true, "mediumseagreen": true, "mediumslateblue": true,
+	"mediumspringgreen": true, "mediumturquoise": true,
+	"mediumvioletred": true, "midnightblue": true, "mintcream": true,
+	"mistyrose": true, "moccasin": true, "navajowhite": true, "navy": true,
+	"oldlace": true, "olive": true, "olivedrab": true, "orange": true,
+	"orangered": true, "orchid": true, "palegoldenrod": true,
+	"palegreen": true, "paleturquoise": true, "palevioletred": true,
+	"papayawhip": true, "peachpuff": true, "peru": true, "pink": true,
+	"plum": true, "powderblue": true, "purple": true, "rebeccapurple": true,
+	"red": true, "rosybrown": true, "royalblue": true, "saddlebrown": true,
+	"salmon": true, "sandybrown": true, "seagreen": true, "seashell": true,
+	"sienna": true, "silver": true, "skyblue": true, "slateblue": true,
+	"slategray": true, "slategrey": true, "snow": true, "springgreen": true,
+	"steelblue": true, "tan": true, "teal": true, "thistle": true,
+	"tomato": true, "turquoise": true, "violet": true, "wheat": true,
+	"white": true, "whitesmoke": true, "yellow": true, "yellowgreen": true,
+	"transparent": true, "currentcolor": true,
+}
+
+// Validate checks all the members of the operation and returns every problem
+// found as ValidationErrors, or nil if there are none. The Field of each
+// problem is the name of the parameter sent to the SWAN Operator. GetURL and
+// GetValues call Validate and return the ValidationErrors before contacting the
+// SWAN Operator. GetURL returns them as the Err of an *Error.
+func (o *Operation) Validate() error {
+	var e ValidationErrors
+	if o.Scheme != "http" && o.Scheme != "https" {
+		e.add(newValidationError("scheme", o.Scheme, "must be http or https"))
+	}
+	if o.Operator == "" {
+		e.add(newValidationError("operator", o.Operator, "required"))
+	} else if _, err := NormalizeHost(o.Operator); err != nil {
+		e.add(newValidationError("operator", o.Operator, "%s", err))
+	}
+	if o.AccessKey == "" {
+		e.add(newValidationError("accessKey", "", "required"))
+	}
+	if o.Request == nil {
+		e.add(newValidationError("request", "", "required"))
+	}
+	if o.ReturnUrl == "" {
+		e.add(newValidationError(fieldReturnURL, "", "required"))
+	} else {
+		p := o.returnURLPolicy
+		if p == nil {
+			p = &ReturnURLPolicy{}
+		}
+		err := p.Check(o.ReturnUrl)
+		if err != nil {
+			var v *ValidationError
+			if errors.As(err, &v) {
+				e.add(v)
+			}
+		}
+	}
+	if o.AccessNode != "" {
+		if _, err := NormalizeHost(o.AccessNode); err != nil {
+			e.add(newValidationError("accessNode", o.AccessNode, "%s", err))
+		}
+	}
+	if o.DisplayUserInterface && strings.TrimSpace(o.Title) == "" {
+		e.add(newValidationError(
+			"title",
+			o.Title,
+			"required when displayUserInterface is true"))
+	}
+	validateColor(&e, "progressColor", o.ProgressColor)
+	validateColor(&e, "backgroundColor", o.BackgroundColor)
+	validateColor(&e, "messageColor", o.MessageColor)
+	if o.NodeCount < 0 || o.NodeCount > MaxNodeCount {
+		e.add(newValidationError(
+			"nodeCount",
+			strconv.Itoa(o.NodeCount),
+			"must be between 0 and %d",
+			MaxNodeCount))
+	}
+	if o.PostMessageOnComplete && o.JavaScript {
+		e.add(newValidationError(
+			"javaScript",
+			"true",
+			"can not be used with postMessageOnComplete"))
+	}
+	if len(e) > 0 {
+		return e
+	}
+	return nil
+}
+
+// validateColor adds a problem to e if the value v of the field f is not empty
+// and not a valid CSS colour.
+func validateColor(e *ValidationErrors, f string, v string) {
+	if v == "" || IsCSSColor(v) {
+		return
+	}
+	e.add(newValidationError(f, v, "must be a CSS color"))
+}
+
+// IsCSSColor returns true if the value is a CSS colour in hex, a named colour
+// or an rgb, hsl, hwb, lab or lch function.
+func IsCSSColor(v string) bool {
+	v = strings.TrimSpace(v)
+	return cssNamedColors[strings.ToLower(v)] ||
+		cssHexRegex.MatchString(v) ||
+		cssFunctionRegex.MatchString(v)
+}
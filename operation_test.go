@@ -0,0 +1,258 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// testConnection returns a connection with the SWAN access values set so that
+// the operations created from it are valid.
+func testConnection(o Operation) *Connection {
+	o.Scheme = "https"
+	o.Operator = "swan-operator.org"
+	o.AccessKey = "key"
+	return NewConnection(o)
+}
+
+// testOperation returns a valid operation.
+func testOperation() *Operation {
+	return &testConnection(Operation{}).NewFetch(
+		httptest.NewRequest("GET", "https://pub.com/", nil),
+		"https://pub.com/swan",
+		nil).Operation
+}
+
+func TestOperationValidate(t *testing.T) {
+	if err := testOperation().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		f   string // Field expected to be rejected
+		set func(o *Operation)
+	}{
+		{"scheme", func(o *Operation) { o.Scheme = "ftp" }},
+		{"operator", func(o *Operation) { o.Operator = "" }},
+		{"operator", func(o *Operation) { o.Operator = "a b" }},
+		{"accessKey", func(o *Operation) { o.AccessKey = "" }},
+		{"request", func(o *Operation) { o.Request = nil }},
+		{"returnUrl", func(o *Operation) { o.ReturnUrl = "" }},
+		{"returnUrl", func(o *Operation) { o.ReturnUrl = "/swan" }},
+		{"returnUrl", func(o *Operation) {
+			o.returnURLPolicy = &ReturnURLPolicy{Hosts: []string{"a.com"}}
+		}},
+		{"accessNode", func(o *Operation) { o.AccessNode = "a b" }},
+		{"title", func(o *Operation) { o.DisplayUserInterface = true }},
+		{"progressColor", func(o *Operation) { o.ProgressColor = "nope" }},
+		{"backgroundColor", func(o *Operation) {
+			o.BackgroundColor = "#12345"
+		}},
+		{"messageColor", func(o *Operation) { o.MessageColor = "rgb(" }},
+		{"nodeCount", func(o *Operation) { o.NodeCount = -1 }},
+		{"nodeCount", func(o *Operation) { o.NodeCount = MaxNodeCount + 1 }},
+		{"javaScript", func(o *Operation) {
+			o.PostMessageOnComplete = true
+			o.JavaScript = true
+		}},
+	} {
+		o := testOperation()
+		v.set(o)
+		var e ValidationErrors
+		if errors.As(o.Validate(), &e) == false || len(e) != 1 {
+			t.Fatalf("'%s' expected one error not '%v'", v.f, o.Validate())
+		}
+		if e.Field(v.f) == nil {
+			t.Fatalf("'%s' expected not '%s'", v.f, e[0].Field)
+		}
+	}
+}
+
+// TestOperationValidateAll checks every problem is returned and that GetURL
+// returns them without contacting the SWAN Operator.
+func TestOperationValidateAll(t *testing.T) {
+	s := testConnection(Operation{}).NewStop(
+		httptest.NewRequest("GET", "https://pub.com/", nil),
+		"https://pub.com/swan",
+		"ads.com")
+	s.AccessKey = ""
+	s.Title = " "
+	s.DisplayUserInterface = true
+	s.NodeCount = -1
+	s.MessageColor = "nope"
+	_, err := s.GetURL()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	var e ValidationErrors
+	if errors.As(err, &e) == false {
+		t.Fatalf("'%v' not ValidationErrors", err)
+	}
+	f := make([]string, len(e))
+	for i, v := range e {
+		f[i] = v.Field
+	}
+	sort.Strings(f)
+	x := []string{"accessKey", "messageColor", "nodeCount", "title"}
+	if !reflect.DeepEqual(f, x) {
+		t.Fatalf("'%v' expected '%v'", f, x)
+	}
+	if strings.Count(err.Error(), ";") != 3 {
+		t.Fatalf("'%s' expected all problems", err.Error())
+	}
+}
+
+// TestResetGetURL checks that reset posts the operation parameters to the reset
+// endpoint of the SWAN Operator and returns the URL in the response.
+func TestResetGetURL(t *testing.T) {
+	e := "https://node.swan-operator.org/reset"
+	var p string
+	var f url.Values
+	o := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			p = r.URL.Path
+			err := r.ParseForm()
+			if err != nil {
+				t.Error(err)
+			}
+			f = r.PostForm
+			fmt.Fprint(w, e)
+		}))
+	defer o.Close()
+	c := NewConnection(Operation{
+		Client: Client{SWAN: SWAN{
+			Scheme:    "http",
+			Operator:  o.Listener.Addr().String(),
+			AccessKey: "key"}}})
+	r := httptest.NewRequest("GET", "https://pub.com/", nil)
+	u, err := c.NewReset(r, "https://pub.com/swan").GetURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != e {
+		t.Fatalf("url '%s' expected '%s'", u, e)
+	}
+	if p != "/swan/api/v1/reset" {
+		t.Fatalf("path '%s' not reset endpoint", p)
+	}
+	x := url.Values{
+		"accessKey":             {"key"},
+		"remoteAddr":            {r.RemoteAddr},
+		"returnUrl":             {"https://pub.com/swan"},
+		"displayUserInterface":  {"false"},
+		"postMessageOnComplete": {"false"},
+		"useHomeNode":           {"false"},
+		"javaScript":            {"false"},
+	}
+	if !reflect.DeepEqual(f, x) {
+		t.Fatalf("parameters '%v' expected '%v'", f, x)
+	}
+}
+
+func TestNewStopFromBid(t *testing.T) {
+	c := testConnection(Operation{})
+	r := httptest.NewRequest("GET", "https://pub.com/", nil)
+	b := testBid()
+	s, err := c.NewStopFromBid(r, "https://pub.com/swan", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Host != "advertiser.com" || len(s.Adverts) != 0 {
+		t.Fatalf("host '%s' adverts '%v'", s.Host, s.Adverts)
+	}
+
+	// The first advertiser domain is used without an advertiser URL.
+	b.AdvertiserURL = ""
+	b.AdvertiserDomains = []string{"Brand.com.", "other.com"}
+	s, err = c.NewStopFromBid(r, "https://pub.com/swan", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Host != "brand.com" {
+		t.Fatalf("host '%s' expected 'brand.com'", s.Host)
+	}
+
+	b.AdvertiserDomains = nil
+	_, err = c.NewStopFromBid(r, "https://pub.com/swan", b)
+	if err == nil {
+		t.Fatal("expected error for bid without advertiser")
+	}
+	_, err = c.NewStopFromBid(r, "https://pub.com/swan", nil)
+	if err == nil {
+		t.Fatal("expected error for nil bid")
+	}
+}
+
+func TestNewStopFromNode(t *testing.T) {
+	c := testConnection(Operation{})
+	r := httptest.NewRequest("GET", "https://pub.com/", nil)
+	n := testNode(t, testBid())
+	o, err := n.GetOWID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := o.AsBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.NewStopFromNode(r, "https://pub.com/swan", n, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Host != "advertiser.com" {
+		t.Fatalf("host '%s' expected 'advertiser.com'", s.Host)
+	}
+	if len(s.Adverts) != 1 || s.Adverts[0] != a {
+		t.Fatalf("adverts '%v' expected '%s'", s.Adverts, a)
+	}
+	q := url.Values{}
+	err = s.setData(&q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q["host"], []string{"advertiser.com"}) ||
+		!reflect.DeepEqual(q["advert"], []string{a}) {
+		t.Fatalf("host '%v' advert '%v'", q["host"], q["advert"])
+	}
+
+	// Only the host is stopped if the advert is not requested.
+	s, err = c.NewStopFromNode(r, "https://pub.com/swan", n, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Host != "advertiser.com" || len(s.Adverts) != 0 {
+		t.Fatalf("host '%s' adverts '%v'", s.Host, s.Adverts)
+	}
+
+	_, err = c.NewStopFromNode(r, "https://pub.com/swan", nil, true)
+	if err == nil {
+		t.Fatal("expected error for nil node")
+	}
+	_, err = c.NewStopFromNode(r, "https://pub.com/swan", &owid.Node{}, true)
+	if err == nil {
+		t.Fatal("expected error for node without a bid")
+	}
+}
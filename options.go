@@ -0,0 +1,131 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+// Option is used to override the defaults from the Connection for a single
+// operation. Options are applied to a copy of the connection defaults so that
+// changes made for one operation do not affect any other operation.
+type Option func(o *Operation)
+
+// WithAccessNode sets the access node that will be used to decrypt the result
+// of the operation.
+func WithAccessNode(n string) Option {
+	return func(o *Operation) { o.AccessNode = n }
+}
+
+// WithTitle sets the title of the progress UI page.
+func WithTitle(t string) Option {
+	return func(o *Operation) { o.Title = t }
+}
+
+// WithMessage sets the text of the message in the progress UI.
+func WithMessage(m string) Option {
+	return func(o *Operation) { o.Message = m }
+}
+
+// WithColors sets the HTML colors of the progress UI. Empty strings leave the
+// existing color unchanged.
+//
+// progress color for the progress indicator
+//
+// background color for the background
+//
+// message color for the message text
+func WithColors(progress string, background string, message string) Option {
+	return func(o *Operation) {
+		if progress != "" {
+			o.ProgressColor = progress
+		}
+		if background != "" {
+			o.BackgroundColor = background
+		}
+		if message != "" {
+			o.MessageColor = message
+		}
+	}
+}
+
+// WithNodeCount sets the number of storage nodes to use for the operation.
+func WithNodeCount(n int) Option {
+	return func(o *Operation) { o.NodeCount = n }
+}
+
+// WithUserInterface sets whether a progress UI is displayed during the
+// operation.
+func WithUserInterface(d bool) Option {
+	return func(o *Operation) { o.DisplayUserInterface = d }
+}
+
+// WithPostMessageOnComplete sets whether the resulting data is returned to the
+// parent using JavaScript postMessage.
+func WithPostMessageOnComplete(p bool) Option {
+	return func(o *Operation) { o.PostMessageOnComplete = p }
+}
+
+// WithUseHomeNode sets whether the home node can be used if it contains
+// current data.
+func WithUseHomeNode(u bool) Option {
+	return func(o *Operation) { o.UseHomeNode = u }
+}
+
+// WithJavaScript sets whether the response for the operation is a JavaScript
+// include that will continue the operation.
+func WithJavaScript(j bool) Option {
+	return func(o *Operation) { o.JavaScript = j }
+}
+
+// WithState replaces the State of the operation with a copy of the strings
+// provided.
+func WithState(s ...string) Option {
+	c := copyStrings(s)
+	return func(o *Operation) { o.State = copyStrings(c) }
+}
+
+// WithAppendState adds a copy of the strings provided to the end of the State
+// of the operation.
+func WithAppendState(s ...string) Option {
+	c := copyStrings(s)
+	return func(o *Operation) { o.State = append(o.State, c...) }
+}
+
+// WithStateSigner sets the signer used to sign the State of the operation. Nil
+// disables signing.
+func WithStateSigner(s StateSigner) Option {
+	return func(o *Operation) { o.StateSigner = s }
+}
+
+// newOperation returns a copy of the connection defaults with the options
+// applied. The State is copied so that the options can not change the
+// defaults.
+func (c *Connection) newOperation(opts []Option) Operation {
+	o := c.operation
+	o.State = copyStrings(o.State)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// copyStrings returns a copy of s, or nil if s is empty.
+func copyStrings(s []string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
@@ -0,0 +1,47 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestNewUnstopOptions checks that the options passed to NewUnstop apply to
+// the operation and do not change the defaults in the connection.
+func TestNewUnstopOptions(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://pub.com/", nil)
+	c := NewConnection(Operation{Title: "Default", State: []string{"a"}})
+	h := []string{"cool-creams.uk", "cool-bikes.uk"}
+	s := c.NewUnstop(
+		r,
+		"https://pub.com/swan",
+		h,
+		WithTitle("Unstop"),
+		WithAppendState("b"))
+	if s.Unstop == false || !reflect.DeepEqual(s.Hosts, h) {
+		t.Fatalf("'%+v' not an unstop of '%v'", s, h)
+	}
+	if s.Title != "Unstop" || !reflect.DeepEqual(s.State, []string{"a", "b"}) {
+		t.Fatalf("options not applied '%s' '%v'", s.Title, s.State)
+	}
+	d := c.NewUnstop(r, "https://pub.com/swan", h)
+	if d.Title != "Default" || !reflect.DeepEqual(d.State, []string{"a"}) {
+		t.Fatalf("defaults changed '%s' '%v'", d.Title, d.State)
+	}
+}
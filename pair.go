@@ -74,6 +74,32 @@ func (p *Pair) AsCookie(
 	}
 }
 
+// ClearCookies adds expired cookies to the response for all the SWAN cookies
+// in the request so that the web browser removes them. Used after a Reset
+// operation.
+//
+// r http request from the web browser containing the cookies
+//
+// w http response to add the expired cookies to
+//
+// s true if the cookies are secure, otherwise false
+func ClearCookies(r *http.Request, w http.ResponseWriter, s bool) {
+	for _, c := range r.Cookies() {
+		if IsSWANCookie(c) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     c.Name,
+				Domain:   getDomain(r.Host),
+				Value:    "",
+				SameSite: http.SameSiteLaxMode,
+				HttpOnly: false,
+				Secure:   s,
+				MaxAge:   -1,
+				Expires:  time.Unix(0, 0),
+			})
+		}
+	}
+}
+
 // AsOWID returns the Value as an OWID structure. Used for SWID, SID and
 // Preferences. If the Value is not an OWID then an error is returned.
 func (p *Pair) AsOWID() (*owid.OWID, error) {
@@ -0,0 +1,260 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// Payloads of the legacy preferences OWID created before the Preferences type
+// was available.
+const (
+	prefOn  = "on"  // Personalized marketing allowed
+	prefOff = "off" // Personalized marketing not allowed
+)
+
+// Preferences contains the user's choices for each of the purposes SWAN data
+// can be used for, the version of the policy the choices were made against and
+// when they were made.
+type Preferences struct {
+	base
+	PersonalizedAds        bool      // True if personalized adverts are allowed
+	Measurement            bool      // True if advert measurement is allowed
+	ContentPersonalization bool      // True if content personalization is allowed
+	PolicyVersion          string    // The version of the policy shown to the user
+	Timestamp              time.Time // The UTC time the choices were made
+	legacy                 bool      // True if parsed from a legacy payload
+}
+
+// NewPreferences returns a new swan.Preferences with the correct version and
+// type set and the Timestamp set to the current time truncated to the second
+// as that is the precision of all the encodings.
+func NewPreferences() *Preferences {
+	return &Preferences{
+		base:      base{preferencesVersion, typePreferences},
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// ParsePreferences returns the preferences contained in the payload of a
+// preferences OWID. The legacy payloads "on" and "off" are treated as a special
+// case where all the purposes are allowed or not allowed, the PolicyVersion is
+// empty and the Timestamp is zero.
+func ParsePreferences(d []byte) (*Preferences, error) {
+	switch string(d) {
+	case prefOn:
+		return newLegacyPreferences(true), nil
+	case prefOff:
+		return newLegacyPreferences(false), nil
+	}
+	p, err := payloadFromBytes(d)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := p.(*Preferences)
+	if ok == false {
+		return nil, fmt.Errorf(
+			"type %s not valid for %s",
+			typeAsString(p.Type()),
+			typeAsString(typePreferences))
+	}
+	return r, nil
+}
+
+// PreferencesFromOWID returns the Preferences created from the OWID payload.
+// For legacy payloads the Timestamp is the date the OWID was created.
+func PreferencesFromOWID(o *owid.OWID) (*Preferences, error) {
+	p, err := ParsePreferences(o.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if p.Timestamp.IsZero() && p.IsLegacy() {
+		p.Timestamp = o.Date
+	}
+	return p, nil
+}
+
+// PreferencesFromNode returns the Preferences created from the Node payload.
+func PreferencesFromNode(n *owid.Node) (*Preferences, error) {
+	o, err := n.GetOWID()
+	if err != nil {
+		return nil, err
+	}
+	return PreferencesFromOWID(o)
+}
+
+// newLegacyPreferences returns preferences for the legacy on or off payload.
+func newLegacyPreferences(on bool) *Preferences {
+	return &Preferences{
+		base:                   base{preferencesVersion, typePreferences},
+		legacy:                 true,
+		PersonalizedAds:        on,
+		Measurement:            on,
+		ContentPersonalization: on,
+	}
+}
+
+// IsLegacy returns true if the preferences were parsed from a legacy "on" or
+// "off" payload.
+func (p *Preferences) IsLegacy() bool {
+	return p.legacy
+}
+
+// AsLegacyString returns the legacy "on" or "off" payload for the preferences
+// based on PersonalizedAds. Used with parties that only support the legacy
+// payload.
+func (p *Preferences) AsLegacyString() string {
+	return onOff(p.PersonalizedAds)
+}
+
+// SetVersion sets the version of the encoding to use when the Preferences are
+// written.
+func (p *Preferences) SetVersion(v byte) error {
+	return p.base.setVersion(typePreferences, v, preferencesVersion)
+}
+
+// Type returns the byte used to identify Preferences in an OWID payload.
+func (p *Preferences) Type() byte { return typePreferences }
+
+func (p *Preferences) fields() []field {
+	return []field{
+		{1, "personalizedAds", &p.PersonalizedAds},
+		{2, "measurement", &p.Measurement},
+		{3, "contentPersonalization", &p.ContentPersonalization},
+		{4, "policyVersion", &p.PolicyVersion},
+		{5, "timestamp", &p.Timestamp},
+	}
+}
+
+// Encode writes the Preferences to the writer.
+func (p *Preferences) Encode(w io.Writer) error {
+	return encode(w, p)
+}
+
+// Decode sets the Preferences from the data read from the reader in any of the
+// supported formats. No more than MaxPayloadLength bytes are read. Legacy
+// payloads are not supported. Use ParsePreferences where they might be
+// present.
+func (p *Preferences) Decode(r io.Reader) error {
+	*p = Preferences{}
+	return decode(r, p)
+}
+
+// AsByteArray returns the Preferences as a byte array.
+func (p *Preferences) AsByteArray() ([]byte, error) {
+	var f bytes.Buffer
+	err := p.writeToBuffer(&f)
+	if err != nil {
+		return nil, err
+	}
+	return f.Bytes(), nil
+}
+
+func (p *Preferences) writeToBuffer(f *bytes.Buffer) error {
+	if p.version == 0 {
+		p.version = preferencesVersion
+	}
+	p.structType = typePreferences
+	err := p.base.writeToBuffer(f)
+	if err != nil {
+		return err
+	}
+	switch p.version {
+	case byte(1):
+		err = p.writeToBufferVersion1(f)
+	default:
+		err = fmt.Errorf("version '%d' not supported", p.version)
+	}
+	return err
+}
+
+func (p *Preferences) writeToBufferVersion1(f *bytes.Buffer) error {
+	err := writeBool(f, p.PersonalizedAds)
+	if err != nil {
+		return err
+	}
+	err = writeBool(f, p.Measurement)
+	if err != nil {
+		return err
+	}
+	err = writeBool(f, p.ContentPersonalization)
+	if err != nil {
+		return err
+	}
+	err = writeString(f, p.PolicyVersion)
+	if err != nil {
+		return err
+	}
+	err = writeTime(f, p.Timestamp)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *Preferences) setFromBuffer(f *bytes.Buffer) error {
+	err := p.base.setFromBuffer(f)
+	if err != nil {
+		return err
+	}
+	if p.structType != typePreferences {
+		return fmt.Errorf(
+			"type %s not valid for %s",
+			typeAsString(p.structType),
+			typeAsString(typePreferences))
+	}
+	switch p.version {
+	case byte(1):
+		err = p.setFromBufferVersion1(f)
+	default:
+		err = fmt.Errorf("version '%d' not supported", p.version)
+	}
+	if err != nil {
+		return err
+	}
+	return checkTrailing(f)
+}
+
+func (p *Preferences) setFromBufferVersion1(f *bytes.Buffer) error {
+	var err error
+	p.PersonalizedAds, err = readBool(f)
+	if err != nil {
+		return err
+	}
+	p.Measurement, err = readBool(f)
+	if err != nil {
+		return err
+	}
+	p.ContentPersonalization, err = readBool(f)
+	if err != nil {
+		return err
+	}
+	p.PolicyVersion, err = readString(f)
+	if err != nil {
+		return err
+	}
+	p.Timestamp, err = readTime(f)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPreferencesLegacy checks that the legacy "on" and "off" payloads are
+// parsed with all the purposes allowed or not allowed and that the result can
+// be written as the current Preferences payload and read back.
+func TestPreferencesLegacy(t *testing.T) {
+	for _, s := range []string{prefOn, prefOff} {
+		t.Run(s, func(t *testing.T) {
+			u := NewConnection(Operation{}).NewUpdate(
+				httptest.NewRequest("GET", "https://cmp.com/", nil),
+				"https://pub.com/swan")
+			u.pref = testOWID("cmp.com", []byte(s))
+			p, err := u.Preferences()
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := s == prefOn
+			if p.IsLegacy() == false ||
+				p.PersonalizedAds != e ||
+				p.Measurement != e ||
+				p.ContentPersonalization != e ||
+				p.PolicyVersion != "" ||
+				p.Timestamp.Equal(testDate) == false {
+				t.Fatalf("'%+v' not legacy '%s'", *p, s)
+			}
+			if p.AsLegacyString() != s {
+				t.Fatalf("legacy '%s' expected '%s'", p.AsLegacyString(), s)
+			}
+
+			// Re-encoding uses the current payload which is not legacy.
+			b, err := p.AsByteArray()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) == s {
+				t.Fatal("legacy payload written")
+			}
+			r, err := ParsePreferences(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.IsLegacy() ||
+				r.PersonalizedAds != e ||
+				r.Measurement != e ||
+				r.ContentPersonalization != e ||
+				r.Timestamp.Equal(testDate) == false {
+				t.Fatalf("'%+v' not re-encoded from '%s'", *r, s)
+			}
+			if r.AsLegacyString() != s {
+				t.Fatalf("legacy '%s' expected '%s'", r.AsLegacyString(), s)
+			}
+
+			// Without the OWID date the timestamp is zero.
+			p, err = ParsePreferences([]byte(s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Timestamp.IsZero() == false {
+				t.Fatalf("timestamp '%s' expected zero", p.Timestamp)
+			}
+			b, err = p.AsByteArray()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err = ParsePreferences(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.PersonalizedAds != e || r.Timestamp.IsZero() == false {
+				t.Fatalf("'%+v' not re-encoded from '%s'", *r, s)
+			}
+		})
+	}
+}
+
+func TestParsePreferencesInvalid(t *testing.T) {
+	for _, s := range []string{"", "On", "yes", "on "} {
+		_, err := ParsePreferences([]byte(s))
+		if err == nil {
+			t.Fatalf("'%s' expected error", s)
+		}
+	}
+	b, err := testBid().AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParsePreferences(b)
+	if err == nil {
+		t.Fatal("bid payload expected error")
+	}
+}
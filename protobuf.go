@@ -0,0 +1,261 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field number of the version in the Payload message in swan.proto. The field
+// number of the message for each SWAN type is the type plus
+// protobufTypeOffset.
+const (
+	protobufVersion    protowire.Number = 1
+	protobufTypeOffset protowire.Number = 2
+)
+
+// marshalProtobuf returns the payload as a Payload message defined in
+// swan.proto preceded by the Protobuf marker.
+func marshalProtobuf(p Payload) ([]byte, error) {
+	var m []byte
+	for _, i := range p.fields() {
+		if isEmptyField(i.value) {
+			continue
+		}
+		var err error
+		m, err = protobufAppendValue(m, protowire.Number(i.number), i.value)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %w", i.name, err)
+		}
+	}
+	t, v := header(p)
+	b := append([]byte(nil), markerProtobuf...)
+	b = protowire.AppendTag(b, protobufVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(v))
+	b = protowire.AppendTag(
+		b,
+		protowire.Number(t)+protobufTypeOffset,
+		protowire.BytesType)
+	b = protowire.AppendBytes(b, m)
+	return b, nil
+}
+
+// unmarshalProtobuf returns the SWAN data structure in the Payload message.
+// Unknown fields are ignored.
+func unmarshalProtobuf(d []byte) (Payload, error) {
+	var v uint64
+	var t protowire.Number
+	var m []byte
+	for len(d) > 0 {
+		n, w, l := protowire.ConsumeTag(d)
+		if l < 0 {
+			return nil, protowire.ParseError(l)
+		}
+		d = d[l:]
+		switch {
+		case n == protobufVersion && w == protowire.VarintType:
+			v, l = protowire.ConsumeVarint(d)
+		case n >= protobufTypeOffset && w == protowire.BytesType:
+			if m != nil {
+				return nil, fmt.Errorf("Payload must contain one type")
+			}
+			t = n
+			m, l = protowire.ConsumeBytes(d)
+		default:
+			l = protowire.ConsumeFieldValue(n, w, d)
+		}
+		if l < 0 {
+			return nil, protowire.ParseError(l)
+		}
+		d = d[l:]
+	}
+	if m == nil {
+		return nil, fmt.Errorf("Payload missing type")
+	}
+	p, err := newPayloadWithHeader(uint64(t-protobufTypeOffset), v)
+	if err != nil {
+		return nil, err
+	}
+	f := make(map[protowire.Number]field)
+	for _, i := range p.fields() {
+		f[protowire.Number(i.number)] = i
+	}
+	for len(m) > 0 {
+		n, w, l := protowire.ConsumeTag(m)
+		if l < 0 {
+			return nil, protowire.ParseError(l)
+		}
+		m = m[l:]
+		i, ok := f[n]
+		if ok {
+			l, err = protobufConsumeValue(m, w, i.value)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s': %w", i.name, err)
+			}
+		} else {
+			l = protowire.ConsumeFieldValue(n, w, m)
+		}
+		if l < 0 {
+			return nil, protowire.ParseError(l)
+		}
+		m = m[l:]
+	}
+	return p, nil
+}
+
+func protobufAppendValue(
+	b []byte,
+	n protowire.Number,
+	v interface{}) ([]byte, error) {
+	switch p := v.(type) {
+	case *string:
+		b = protowire.AppendTag(b, n, protowire.BytesType)
+		b = protowire.AppendString(b, *p)
+	case *[]byte:
+		b = protowire.AppendTag(b, n, protowire.BytesType)
+		b = protowire.AppendBytes(b, *p)
+	case *[]string:
+		for _, s := range *p {
+			b = protowire.AppendTag(b, n, protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	case *uint16:
+		b = protowire.AppendTag(b, n, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*p))
+	case *float64:
+		b = protowire.AppendTag(b, n, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*p))
+	case *bool:
+		b = protowire.AppendTag(b, n, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(*p))
+	case *BidFormat:
+		b = protowire.AppendTag(b, n, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*p))
+	case *time.Time:
+		s, err := timeAsUnix(*p)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, n, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s))
+	case *time.Duration:
+		s, err := durationAsSeconds(*p)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, n, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s))
+	case **owid.OWID:
+		o, err := (*p).AsByteArray()
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, n, protowire.BytesType)
+		b = protowire.AppendBytes(b, o)
+	default:
+		return nil, fmt.Errorf("type '%T' not supported", v)
+	}
+	return b, nil
+}
+
+// protobufConsumeValue sets the member pointed to by v from the value at the
+// start of b with the wire type w. Returns the number of bytes consumed or a
+// negative value if the value could not be parsed.
+func protobufConsumeValue(
+	b []byte,
+	w protowire.Type,
+	v interface{}) (int, error) {
+	var x uint64
+	var d []byte
+	var l int
+	switch w {
+	case protowire.VarintType:
+		x, l = protowire.ConsumeVarint(b)
+	case protowire.Fixed64Type:
+		x, l = protowire.ConsumeFixed64(b)
+	case protowire.BytesType:
+		d, l = protowire.ConsumeBytes(b)
+	default:
+		return 0, fmt.Errorf("wire type '%d' not supported", w)
+	}
+	if l < 0 {
+		return l, nil
+	}
+	var e protowire.Type
+	var err error
+	switch p := v.(type) {
+	case *string:
+		e = protowire.BytesType
+		if len(d) > MaxStringLength {
+			err = fmt.Errorf("'%d' bytes: %w", len(d), ErrTooLong)
+		}
+		*p = string(d)
+	case *[]byte:
+		e = protowire.BytesType
+		if len(d) > MaxByteArrayLength {
+			err = fmt.Errorf("'%d' bytes: %w", len(d), ErrTooLong)
+		}
+		*p = append([]byte(nil), d...)
+	case *[]string:
+		e = protowire.BytesType
+		if len(*p) >= MaxArrayLength || len(d) > MaxStringLength {
+			err = fmt.Errorf("repeated string: %w", ErrTooLong)
+		}
+		*p = append(*p, string(d))
+	case *uint16:
+		e = protowire.VarintType
+		if x > math.MaxUint16 {
+			err = fmt.Errorf("'%d' exceeds '%d'", x, math.MaxUint16)
+		}
+		*p = uint16(x)
+	case *float64:
+		e = protowire.Fixed64Type
+		*p = math.Float64frombits(x)
+	case *bool:
+		e = protowire.VarintType
+		*p = protowire.DecodeBool(x)
+	case *BidFormat:
+		e = protowire.VarintType
+		if x > math.MaxUint8 {
+			err = fmt.Errorf("'%d' exceeds '%d'", x, math.MaxUint8)
+		}
+		*p = BidFormat(x)
+	case *time.Time:
+		e = protowire.VarintType
+		*p, err = timeFromUnix(int64(x))
+	case *time.Duration:
+		e = protowire.VarintType
+		if x > math.MaxUint32 {
+			err = fmt.Errorf("'%d' exceeds '%d'", x, math.MaxUint32)
+		}
+		*p = time.Duration(x) * time.Second
+	case **owid.OWID:
+		e = protowire.BytesType
+		*p, err = owidFromBytes(d)
+	default:
+		return 0, fmt.Errorf("type '%T' not supported", v)
+	}
+	if e != w {
+		return 0, fmt.Errorf("wire type '%d' not valid", w)
+	}
+	return l, err
+}
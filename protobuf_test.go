@@ -0,0 +1,288 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bufio"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Lines of swan.proto that are understood by testProtoFile.
+var (
+	protoMessageRegex = regexp.MustCompile(`^message (\w+) \{(\})?$`)
+	protoEnumRegex    = regexp.MustCompile(`^enum (\w+) \{$`)
+	protoOneofRegex   = regexp.MustCompile(`^oneof (\w+) \{$`)
+	protoFieldRegex   = regexp.MustCompile(
+		`^(repeated )?(\w+) (\w+) = (\d+);`)
+	protoEnumValueRegex = regexp.MustCompile(`^(\w+) = (\d+);`)
+)
+
+// Scalar types in swan.proto.
+var protoScalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":  descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	"uint32": descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"double": descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+}
+
+// testProtoFile returns the descriptor for swan.proto so that the Protobuf
+// runtime can be used to check protobuf.go agrees with the published schema.
+// Only the subset of the language used by swan.proto is supported.
+func testProtoFile(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	r, err := os.Open("swan.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	f := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("swan.proto"),
+		Package: proto.String("swan"),
+		Syntax:  proto.String("proto3"),
+	}
+	enums := map[string]bool{}
+	var m *descriptorpb.DescriptorProto
+	var e *descriptorpb.EnumDescriptorProto
+	oneof := int32(-1)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if i := strings.Index(l, "//"); i >= 0 {
+			l = strings.TrimSpace(l[:i])
+		}
+		switch {
+		case l == "" ||
+			strings.HasPrefix(l, "syntax") ||
+			strings.HasPrefix(l, "package") ||
+			strings.HasPrefix(l, "option"):
+		case protoMessageRegex.MatchString(l):
+			v := protoMessageRegex.FindStringSubmatch(l)
+			m = &descriptorpb.DescriptorProto{Name: proto.String(v[1])}
+			f.MessageType = append(f.MessageType, m)
+			if v[2] != "" {
+				m = nil
+			}
+		case protoEnumRegex.MatchString(l):
+			v := protoEnumRegex.FindStringSubmatch(l)
+			e = &descriptorpb.EnumDescriptorProto{Name: proto.String(v[1])}
+			f.EnumType = append(f.EnumType, e)
+			enums[v[1]] = true
+		case protoOneofRegex.MatchString(l):
+			v := protoOneofRegex.FindStringSubmatch(l)
+			m.OneofDecl = append(
+				m.OneofDecl,
+				&descriptorpb.OneofDescriptorProto{Name: proto.String(v[1])})
+			oneof = int32(len(m.OneofDecl) - 1)
+		case l == "}":
+			switch {
+			case oneof >= 0:
+				oneof = -1
+			case e != nil:
+				e = nil
+			default:
+				m = nil
+			}
+		case e != nil && protoEnumValueRegex.MatchString(l):
+			v := protoEnumValueRegex.FindStringSubmatch(l)
+			n, _ := strconv.Atoi(v[2])
+			e.Value = append(e.Value, &descriptorpb.EnumValueDescriptorProto{
+				Name:   proto.String(v[1]),
+				Number: proto.Int32(int32(n))})
+		case m != nil && protoFieldRegex.MatchString(l):
+			v := protoFieldRegex.FindStringSubmatch(l)
+			n, _ := strconv.Atoi(v[4])
+			d := &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(v[3]),
+				Number: proto.Int32(int32(n)),
+				Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.
+					Enum(),
+			}
+			if v[1] != "" {
+				d.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.
+					Enum()
+			}
+			if st, ok := protoScalarTypes[v[2]]; ok {
+				d.Type = st.Enum()
+			} else if enums[v[2]] {
+				d.Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+				d.TypeName = proto.String(".swan." + v[2])
+			} else {
+				d.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				d.TypeName = proto.String(".swan." + v[2])
+			}
+			if oneof >= 0 {
+				d.OneofIndex = proto.Int32(oneof)
+			}
+			m.Field = append(m.Field, d)
+		default:
+			t.Fatalf("swan.proto line '%s' not supported", l)
+		}
+	}
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+	d, err := protodesc.NewFile(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// protoKind returns the kind of Protobuf field used for the member pointed to
+// by v in the SWAN data structures.
+func protoKind(v interface{}) protoreflect.Kind {
+	switch v.(type) {
+	case *string, *[]string:
+		return protoreflect.StringKind
+	case *[]byte, **owid.OWID:
+		return protoreflect.BytesKind
+	case *uint16, *time.Duration:
+		return protoreflect.Uint32Kind
+	case *float64:
+		return protoreflect.DoubleKind
+	case *bool:
+		return protoreflect.BoolKind
+	case *BidFormat:
+		return protoreflect.EnumKind
+	case *time.Time:
+		return protoreflect.Int64Kind
+	}
+	return 0
+}
+
+// TestProtobufSchema checks that the field numbers, names and types in the
+// fields tables used by protobuf.go match the messages in swan.proto.
+func TestProtobufSchema(t *testing.T) {
+	d := testProtoFile(t)
+	pm := d.Messages().ByName("Payload")
+	if pm == nil {
+		t.Fatal("Payload message missing")
+	}
+	v := pm.Fields().ByNumber(protobufVersion)
+	if v == nil || v.Kind() != protoreflect.Uint32Kind {
+		t.Fatal("Payload version field incorrect")
+	}
+	for _, tp := range testPayloads() {
+		p := tp.new()
+		pf := pm.Fields().ByNumber(
+			protoreflect.FieldNumber(p.Type()) +
+				protoreflect.FieldNumber(protobufTypeOffset))
+		if pf == nil || pf.Message() == nil {
+			t.Fatalf("%s: Payload field missing", tp.name)
+		}
+		m := pf.Message()
+		if string(m.Name()) != typeAsString(p.Type()) {
+			t.Fatalf("%s: message '%s' not expected", tp.name, m.Name())
+		}
+		fs := p.fields()
+		if len(fs) != m.Fields().Len() {
+			t.Fatalf(
+				"%s: '%d' fields but '%d' in swan.proto",
+				tp.name,
+				len(fs),
+				m.Fields().Len())
+		}
+		for _, f := range fs {
+			mf := m.Fields().ByNumber(protoreflect.FieldNumber(f.number))
+			if mf == nil {
+				t.Fatalf("%s: field '%s' missing", tp.name, f.name)
+			}
+			if mf.JSONName() != f.name {
+				t.Fatalf(
+					"%s: field '%d' is '%s' not '%s'",
+					tp.name,
+					f.number,
+					mf.JSONName(),
+					f.name)
+			}
+			if mf.Kind() != protoKind(f.value) {
+				t.Fatalf(
+					"%s: field '%s' is '%s' not '%s'",
+					tp.name,
+					f.name,
+					mf.Kind(),
+					protoKind(f.value))
+			}
+			_, r := f.value.(*[]string)
+			if mf.IsList() != r {
+				t.Fatalf("%s: field '%s' repeated mismatch", tp.name, f.name)
+			}
+		}
+	}
+}
+
+// TestProtobufRuntime checks that payloads encoded by protobuf.go are read by
+// the Protobuf runtime using swan.proto without any unknown fields, and that
+// the runtime's encoding is read back to the same structure.
+func TestProtobufRuntime(t *testing.T) {
+	d := testProtoFile(t)
+	pm := d.Messages().ByName("Payload")
+	for _, tp := range testPayloads() {
+		e := withHeader(tp.new())
+		b, err := Marshal(e, FormatProtobuf)
+		if err != nil {
+			t.Fatalf("%s: %s", tp.name, err)
+		}
+		m := dynamicpb.NewMessage(pm)
+		err = proto.Unmarshal(b[len(markerProtobuf):], m)
+		if err != nil {
+			t.Fatalf("%s: %s", tp.name, err)
+		}
+		testProtoNoUnknown(t, tp.name, m)
+		r, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		if err != nil {
+			t.Fatalf("%s: %s", tp.name, err)
+		}
+		p, err := unmarshalProtobuf(r)
+		if err != nil {
+			t.Fatalf("%s: %s", tp.name, err)
+		}
+		if !reflect.DeepEqual(p, e) {
+			t.Fatalf("%s: decoded\n%+v\nexpected\n%+v", tp.name, p, e)
+		}
+	}
+}
+
+// testProtoNoUnknown fails the test if the message or any of the messages it
+// contains have fields that are not in swan.proto.
+func testProtoNoUnknown(t *testing.T, n string, m protoreflect.Message) {
+	t.Helper()
+	if len(m.GetUnknown()) > 0 {
+		t.Fatalf("%s: unknown fields in '%s'", n, m.Descriptor().Name())
+	}
+	m.Range(func(f protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if f.Message() != nil && !f.IsList() && !f.IsMap() {
+			testProtoNoUnknown(t, n, v.Message())
+		}
+		return true
+	})
+}
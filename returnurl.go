@@ -0,0 +1,268 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Field name used in validation errors for the return URL.
+const fieldReturnURL = "returnUrl"
+
+// Characters that can appear in the encrypted data appended to a return URL.
+var encryptedRegex = regexp.MustCompile(`^[A-Za-z0-9+/=_-]+$`)
+
+// ReturnURLPolicy restricts the return URLs that can be used with storage
+// operations so that the web browser and the encrypted SWAN data can only be
+// sent to expected places. A return URL is allowed if it matches all of the
+// rules that are set.
+type ReturnURLPolicy struct {
+	// Hosts that are allowed. A host starting with "*." allows any sub domain
+	// of the host but not the host itself. A host only allows the default
+	// port of the scheme unless a port is included, for example
+	// "pub.com:8443". If empty any host is allowed.
+	Hosts []string
+	// Regular expressions that match the whole return URL. If empty any URL
+	// is allowed.
+	Patterns []*regexp.Regexp
+	// HTTPSOnly true if only HTTPS return URLs are allowed.
+	HTTPSOnly bool
+	// Prefixes of the unescaped path that are allowed. A prefix that does not
+	// end with "/" matches whole segments only. If empty any path is allowed
+	// that does not contain "." or ".." segments.
+	PathPrefixes []string
+}
+
+// Return contains the data from a request to a return URL after a storage
+// operation has completed.
+type Return struct {
+	URL       *url.URL               // The URL the browser returned to
+	Encrypted string                 // The encrypted SWAN data
+	Raw       map[string]interface{} // Raw SWAN data if decrypted
+	State     []string               // The state from the raw SWAN data
+}
+
+// Check returns a *ValidationError if the return URL is not allowed by the
+// policy.
+func (p *ReturnURLPolicy) Check(returnUrl string) error {
+	u, err := url.Parse(returnUrl)
+	if err != nil {
+		return newValidationError(fieldReturnURL, returnUrl, "%s", err)
+	}
+	if u.IsAbs() == false || u.Host == "" {
+		return newValidationError(fieldReturnURL, returnUrl, "must be absolute")
+	}
+	if u.Scheme != "https" && (p.HTTPSOnly || u.Scheme != "http") {
+		return newValidationError(
+			fieldReturnURL,
+			returnUrl,
+			"scheme '%s' not allowed",
+			u.Scheme)
+	}
+	if u.User != nil {
+		return newValidationError(
+			fieldReturnURL,
+			returnUrl,
+			"must not contain user information")
+	}
+	if len(p.Hosts) > 0 && p.allowsHost(u) == false {
+		return newValidationError(
+			fieldReturnURL,
+			returnUrl,
+			"host '%s' not allowed",
+			u.Host)
+	}
+	if p.allowsPath(u.EscapedPath()) == false {
+		return newValidationError(
+			fieldReturnURL,
+			returnUrl,
+			"path '%s' not allowed",
+			u.Path)
+	}
+	if len(p.Patterns) > 0 && p.allowsURL(returnUrl) == false {
+		return newValidationError(
+			fieldReturnURL,
+			returnUrl,
+			"does not match an allowed pattern")
+	}
+	return nil
+}
+
+// allowsHost returns true if the host and port of the URL match one of the
+// hosts. A host without a port only matches the default port of the scheme.
+func (p *ReturnURLPolicy) allowsHost(u *url.URL) bool {
+	n, err := NormalizeHost(u.Hostname())
+	if err != nil {
+		return false
+	}
+	o := defaultPort(u.Scheme, u.Port())
+	for _, a := range p.Hosts {
+		s := strings.HasPrefix(a, "*.")
+		a = strings.TrimPrefix(a, "*.")
+		t := ""
+		if h, q, err := net.SplitHostPort(a); err == nil {
+			a, t = h, q
+		}
+		m, err := NormalizeHost(a)
+		if err != nil || defaultPort(u.Scheme, t) != o {
+			continue
+		}
+		if (s == false && n == m) || (s && strings.HasSuffix(n, "."+m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPort returns an empty string if the port is the default for the
+// scheme, otherwise the port.
+func defaultPort(scheme string, port string) string {
+	if (scheme == "https" && port == "443") ||
+		(scheme == "http" && port == "80") {
+		return ""
+	}
+	return port
+}
+
+// allowsPath returns true if the unescaped path starts with one of the
+// prefixes at a segment boundary, or there are no prefixes. Paths containing "." or ".." segments are
+// never allowed as the web browser would resolve them to a different path.
+func (p *ReturnURLPolicy) allowsPath(e string) bool {
+	s, err := url.PathUnescape(e)
+	if err != nil {
+		return false
+	}
+	if s == "" {
+		s = "/"
+	}
+	for _, i := range strings.Split(strings.ReplaceAll(s, "\\", "/"), "/") {
+		if i == "." || i == ".." {
+			return false
+		}
+	}
+	if len(p.PathPrefixes) == 0 {
+		return true
+	}
+	for _, a := range p.PathPrefixes {
+		if strings.HasSuffix(a, "/") {
+			if strings.HasPrefix(s, a) {
+				return true
+			}
+		} else if s == a || strings.HasPrefix(s, a+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsURL returns true if the URL matches one of the patterns.
+func (p *ReturnURLPolicy) allowsURL(u string) bool {
+	for _, r := range p.Patterns {
+		l := r.FindStringIndex(u)
+		if l != nil && l[0] == 0 && l[1] == len(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseReturn returns the encrypted SWAN data from a request to the return
+// URL after a storage operation has completed. The request must have the same
+// host as the return URL and a path that starts with the path of the return
+// URL followed by the encrypted data. The scheme must match if it is known
+// from the request. An error is returned if the request is not for the return
+// URL, if the return URL is not allowed by the return URL policy of the
+// connection or if the encrypted data is missing or invalid. If raw is true
+// the encrypted data is decrypted with DecryptRaw to provide the raw data and
+// state.
+//
+// r http request from the web browser to the return URL
+//
+// returnUrl the return URL provided to the storage operation
+//
+// raw true if the data should be decrypted with DecryptRaw
+func (c *Connection) ParseReturn(
+	r *http.Request,
+	returnUrl string,
+	raw bool) (*Return, error) {
+	if c.operation.returnURLPolicy != nil {
+		err := c.operation.returnURLPolicy.Check(returnUrl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ru, err := url.Parse(returnUrl)
+	if err != nil || ru.IsAbs() == false || ru.Host == "" {
+		return nil, newValidationError(
+			fieldReturnURL,
+			returnUrl,
+			"must be absolute")
+	}
+	u := requestURL(r)
+	if u.Scheme == "" {
+		u.Scheme = ru.Scheme
+	}
+	p := strings.TrimSuffix(ru.EscapedPath(), "/")
+	q := u.EscapedPath()
+	if strings.EqualFold(u.Scheme, ru.Scheme) == false ||
+		strings.EqualFold(u.Host, ru.Host) == false ||
+		strings.HasPrefix(q, p+"/") == false {
+		return nil, newValidationError(
+			fieldReturnURL,
+			u.String(),
+			"request not for return URL '%s'",
+			returnUrl)
+	}
+	e, err := url.PathUnescape(q[len(p)+1:])
+	if err != nil || e == "" || encryptedRegex.MatchString(e) == false {
+		return nil, fmt.Errorf("encrypted data missing or invalid")
+	}
+	t := Return{URL: u, Encrypted: e}
+	if raw {
+		var se *Error
+		t.Raw, se = c.DecryptRaw(e)
+		if se != nil {
+			return nil, se
+		}
+		t.State = RawState(t.Raw)
+	}
+	return &t, nil
+}
+
+// requestURL returns the URL of the request with the host set. The scheme is
+// HTTPS if the request used TLS, otherwise the X-Forwarded-Proto header if
+// present. The scheme is empty if it is not known, such as behind a proxy that
+// terminates TLS and does not set X-Forwarded-Proto.
+func requestURL(r *http.Request) *url.URL {
+	u := *r.URL
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		if r.TLS != nil {
+			u.Scheme = "https"
+		} else {
+			u.Scheme = strings.ToLower(r.Header.Get("X-Forwarded-Proto"))
+		}
+	}
+	return &u
+}
@@ -0,0 +1,117 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseReturn(t *testing.T) {
+	c := NewConnection(Operation{})
+	for _, v := range []struct {
+		returnUrl string
+		request   string
+		proto     string // X-Forwarded-Proto header
+		tls       bool
+		e         string // Expected encrypted data, or empty if rejected
+	}{
+		{"https://pub.com/swan", "https://pub.com/swan/abc", "", false, "abc"},
+		{"https://pub.com/swan/", "http://pub.com/swan/abc", "", false, "abc"},
+		{"https://pub.com", "http://pub.com/abc", "", false, "abc"},
+		{"https://pub.com/swan", "http://PUB.com/swan/a%2Bb", "", true, "a+b"},
+		{"https://pub.com/swan", "http://pub.com/swan/abc", "https", false,
+			"abc"},
+		{"https://pub.com/swan", "http://pub.com/swanevil/xyz", "", false, ""},
+		{"https://pub.com/swan", "http://pub.com/swan", "", false, ""},
+		{"https://pub.com/swan", "http://pub.com/swan/", "", false, ""},
+		{"https://pub.com/swan", "http://evil.com/swan/abc", "", false, ""},
+		{"https://pub.com/swan", "http://pub.com.evil.com/swan/abc", "", false,
+			""},
+		{"https://pub.com/swan", "http://pub.com/swan/abc", "http", false, ""},
+		{"http://pub.com/swan", "http://pub.com/swan/abc", "", true, ""},
+		{"/swan", "http://pub.com/swan/abc", "", false, ""},
+	} {
+		r := httptest.NewRequest("GET", v.request, nil)
+		r.URL.Scheme = ""
+		r.URL.Host = ""
+		r.TLS = nil
+		if v.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		if v.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", v.proto)
+		}
+		p, err := c.ParseReturn(r, v.returnUrl, false)
+		if v.e == "" {
+			if err == nil {
+				t.Fatalf("'%s' for '%s' expected error", v.request, v.returnUrl)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("'%s' for '%s' %s", v.request, v.returnUrl, err)
+		}
+		if p.Encrypted != v.e {
+			t.Fatalf("'%s' expected '%s'", p.Encrypted, v.e)
+		}
+	}
+}
+
+func TestReturnURLPolicy(t *testing.T) {
+	p := &ReturnURLPolicy{
+		Hosts:        []string{"pub.com", "*.cdn.com", "dev.com:8443"},
+		PathPrefixes: []string{"/swan/", "/return"}}
+	for _, v := range []struct {
+		u  string
+		ok bool
+	}{
+		{"https://pub.com/swan/x", true},
+		{"https://pub.com:443/swan/x", true},
+		{"http://pub.com:80/swan/x", true},
+		{"https://a.cdn.com/swan/x", true},
+		{"https://dev.com:8443/swan/x", true},
+		{"https://pub.com/return", true},
+		{"https://pub.com/return/x", true},
+		{"https://pub.com/sw%61n/x", true},
+		{"https://pub.com:8443/swan/x", false},
+		{"https://dev.com/swan/x", false},
+		{"https://cdn.com/swan/x", false},
+		{"https://evil.com/swan/x", false},
+		{"https://pub.com/swan/../admin/x", false},
+		{"https://pub.com/swan/%2e%2e/admin", false},
+		{"https://pub.com/swan/%2E%2E%2Fadmin", false},
+		{"https://pub.com/swan/./x", false},
+		{"https://pub.com/swan/..%5Cadmin", false},
+		{"https://pub.com/returnevil", false},
+		{"https://pub.com/swan", false},
+		{"https://pub.com/admin", false},
+		{"https://pub.com/swan/%zz", false},
+	} {
+		err := p.Check(v.u)
+		if v.ok && err != nil {
+			t.Fatalf("'%s' %s", v.u, err)
+		}
+		if v.ok == false && err == nil {
+			t.Fatalf("'%s' expected error", v.u)
+		}
+	}
+	if err := (&ReturnURLPolicy{}).Check("https://pub.com/a/../b"); err == nil {
+		t.Fatal("expected error for dot segment without prefixes")
+	}
+}
@@ -0,0 +1,126 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/SWAN-community/owid-go"
+	"golang.org/x/net/idna"
+)
+
+// emailRule contains the provider specific rules for normalizing the local
+// part of an email address.
+type emailRule struct {
+	domain     string // The domain to use for the provider
+	ignoreDots bool   // True if dots in the local part are ignored
+	subaddress byte   // Separator of the tag that is ignored, or 0 if none
+}
+
+// Providers with known rules for the local part of email addresses. Domains
+// that are aliases of each other map to the same domain. Yahoo is not included
+// as its disposable addresses use a base name chosen by the user rather than
+// the account name, so removing the keyword after a dash can not recover the
+// account and would merge distinct addresses.
+var emailRules = map[string]emailRule{
+	"gmail.com":      {"gmail.com", true, '+'},
+	"googlemail.com": {"gmail.com", true, '+'},
+	"outlook.com":    {"outlook.com", false, '+'},
+	"hotmail.com":    {"hotmail.com", false, '+'},
+	"live.com":       {"live.com", false, '+'},
+	"icloud.com":     {"icloud.com", false, '+'},
+	"me.com":         {"icloud.com", false, '+'},
+	"mac.com":        {"icloud.com", false, '+'},
+	"fastmail.com":   {"fastmail.com", false, '+'},
+	"protonmail.com": {"protonmail.com", false, '+'},
+	"proton.me":      {"protonmail.com", false, '+'},
+}
+
+// NormalizeEmail returns the email address in the form used to derive the
+// SID. White space is removed, the address is lower cased, the domain is
+// converted to ASCII and provider specific rules such as ignoring dots and
+// plus suffixes in Gmail addresses are applied.
+func NormalizeEmail(email string) (string, error) {
+	e := strings.ToLower(strings.Join(strings.Fields(email), ""))
+	i := strings.LastIndex(e, "@")
+	if i <= 0 || i == len(e)-1 {
+		return "", fmt.Errorf("email '%s' invalid", email)
+	}
+	l, d := e[:i], e[i+1:]
+	d, err := idna.Lookup.ToASCII(strings.TrimSuffix(d, "."))
+	if err != nil {
+		return "", fmt.Errorf("email '%s' domain invalid: %s", email, err)
+	}
+	r, ok := emailRules[d]
+	if ok {
+		d = r.domain
+		if r.subaddress != 0 {
+			if j := strings.IndexByte(l, r.subaddress); j >= 0 {
+				l = l[:j]
+			}
+		}
+		if r.ignoreDots {
+			l = strings.ReplaceAll(l, ".", "")
+		}
+		if l == "" {
+			return "", fmt.Errorf("email '%s' invalid", email)
+		}
+	}
+	return l + "@" + d, nil
+}
+
+// NewSID returns the SID for the email and salt. The SID is the SHA-256 hash
+// of the normalized email followed by the bytes of the salt.
+//
+// email provided by the user
+//
+// salt base 64 encoded salt string from salt-js
+func NewSID(email string, salt string) ([]byte, error) {
+	e, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	s, err := decodeSalt(salt)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write([]byte(e))
+	h.Write(s)
+	return h.Sum(nil), nil
+}
+
+// CreateSID returns the SID for the email and salt as an OWID signed by the
+// creator. See NewSID.
+//
+// creator register OWID creator for the User Interface Provider
+//
+// email provided by the user
+//
+// salt base 64 encoded salt string from salt-js
+func CreateSID(
+	creator *owid.Creator,
+	email string,
+	salt string) (*owid.OWID, error) {
+	s, err := NewSID(email, salt)
+	if err != nil {
+		return nil, err
+	}
+	return creator.CreateOWIDandSign(s)
+}
@@ -0,0 +1,89 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+const testSalt = "AQI=" // Bytes 0x01 0x02
+
+func TestNormalizeEmail(t *testing.T) {
+	for _, v := range []struct {
+		email string
+		e     string
+	}{
+		{"John.Smith@Gmail.com", "johnsmith@gmail.com"},
+		{"john.smith+news@gmail.com", "johnsmith@gmail.com"},
+		{"j.o.h.n.smith@googlemail.com", "johnsmith@gmail.com"},
+		{" JOHN.SMITH@GMAIL.COM.\t", "johnsmith@gmail.com"},
+		{"jane+news@outlook.com", "jane@outlook.com"},
+		{"jane.doe@outlook.com", "jane.doe@outlook.com"},
+		{"user@me.com", "user@icloud.com"},
+		{"user@Bücher.example", "user@xn--bcher-kva.example"},
+		{"user+tag@example.com", "user+tag@example.com"},
+		{"mary-shopping@yahoo.com", "mary-shopping@yahoo.com"},
+	} {
+		n, err := NormalizeEmail(v.email)
+		if err != nil {
+			t.Fatalf("'%s' %s", v.email, err)
+		}
+		if n != v.e {
+			t.Fatalf("'%s' gave '%s' expected '%s'", v.email, n, v.e)
+		}
+	}
+	for _, e := range []string{
+		"",
+		"user",
+		"@gmail.com",
+		"user@",
+		"+tag@gmail.com"} {
+		if _, err := NormalizeEmail(e); err == nil {
+			t.Fatalf("'%s' expected error", e)
+		}
+	}
+}
+
+// TestNewSID checks the SID is the SHA-256 hash of the normalized email and
+// the salt bytes, and that addresses for the same mailbox have the same SID.
+func TestNewSID(t *testing.T) {
+	for _, v := range []struct {
+		email string
+		e     string
+	}{
+		{"John.Smith@gmail.com",
+			"f27b6fc7cdf2c3e808c294532597345d387192cf61d94880b154ed46eac43f56"},
+		{"johnsmith+news@googlemail.com",
+			"f27b6fc7cdf2c3e808c294532597345d387192cf61d94880b154ed46eac43f56"},
+		{"User@Bücher.example",
+			"10249af6ed09035f0dd64fcbf928a1f6992cf209a1aeaee80e20d2e7a3f6162a"},
+		{" jane+news@Outlook.com ",
+			"3c331f61d5758d63c441dee53dad647019f03b5f62e6dcd10cbd5b7836a6b47c"},
+	} {
+		s, err := NewSID(v.email, testSalt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := hex.EncodeToString(s); h != v.e {
+			t.Fatalf("'%s' gave '%s' expected '%s'", v.email, h, v.e)
+		}
+	}
+	if _, err := NewSID("johnsmith@gmail.com", "A"); err == nil {
+		t.Fatal("expected salt error")
+	}
+}
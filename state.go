@@ -0,0 +1,437 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+)
+
+// Prefix of the state item that contains the signature of the other items.
+const stateTokenPrefix = "swan-sig:"
+
+// Values used in the state token.
+const (
+	stateTokenVersion byte = 1
+	stateKindHMAC     byte = 1 // Signed with a shared HMAC key
+	stateKindOWID     byte = 2 // Signed with an OWID creator
+	stateNonceLength       = 16
+	stateDefaultTTL        = 10 * time.Minute
+	stateClockSkew         = time.Minute
+)
+
+var (
+	// ErrStateUnsigned is returned when the state does not contain a
+	// signature.
+	ErrStateUnsigned = errors.New("state not signed")
+	// ErrStateModified is returned when the signature does not match the
+	// state.
+	ErrStateModified = errors.New("state modified")
+	// ErrStateExpired is returned when the state has expired.
+	ErrStateExpired = errors.New("state expired")
+	// ErrStateReplayed is returned when the state has already been verified.
+	ErrStateReplayed = errors.New("state replayed")
+	// ErrStateIssuer is returned when the state was signed by an issuer that
+	// is not trusted.
+	ErrStateIssuer = errors.New("state issuer not trusted")
+)
+
+// StateSigner is used to sign the State of an operation so that the party
+// that receives the results of the storage operation can verify it has not
+// been modified.
+type StateSigner interface {
+	// SignState returns the state with an additional item containing the
+	// signature.
+	SignState(state []string) ([]string, error)
+}
+
+// NonceStore records the nonces of state that has been verified so that the
+// same state can not be used twice.
+type NonceStore interface {
+	// Use records the nonce returning false if it has already been used. The
+	// nonce only needs to be retained until the expiry time.
+	Use(nonce []byte, expires time.Time) bool
+}
+
+// HMACStateSigner signs state with a key shared with the verifier.
+type HMACStateSigner struct {
+	Issuer string        // Name of the party signing the state
+	Key    []byte        // Key shared with the StateVerifier
+	TTL    time.Duration // How long the state is valid, default 10 minutes
+}
+
+// OWIDStateSigner signs state with an OWID creator. The issuer is the domain
+// of the creator.
+type OWIDStateSigner struct {
+	Creator *owid.Creator // Creator used to sign the state
+	TTL     time.Duration // How long the state is valid, default 10 minutes
+}
+
+// StateVerifier verifies state signed with a StateSigner.
+type StateVerifier struct {
+	// Keys shared with each HMACStateSigner keyed on the Issuer of the
+	// signer. HMAC signed state is only trusted if the key for the issuer in
+	// the state is present so that one issuer can not sign as another.
+	Keys map[string][]byte
+	// Domains of the OWIDStateSigner creators that are trusted.
+	Issuers []string
+	// Used to reject state that has already been verified. If nil replayed
+	// state is not detected.
+	Nonces NonceStore
+	// Public keys in PEM format of the OWID issuers. If the public key for an
+	// issuer is not present it is fetched from the issuer's domain.
+	PublicKeys map[string]string
+	// Scheme used to fetch public keys for OWID issuers. Default https.
+	Scheme string
+}
+
+// NonceCache is an in memory NonceStore. Expired nonces are removed when new
+// nonces are used.
+type NonceCache struct {
+	mutex  sync.Mutex
+	nonces map[string]time.Time
+}
+
+// stateToken contains the information needed to verify the state.
+type stateToken struct {
+	kind    byte
+	issuer  string
+	nonce   []byte
+	issued  time.Time
+	expires time.Time
+	sig     []byte // HMAC or OWID bytes
+}
+
+// NewNonceCache returns a new empty in memory nonce store.
+func NewNonceCache() *NonceCache {
+	return &NonceCache{nonces: make(map[string]time.Time)}
+}
+
+// Use records the nonce returning false if it has already been used.
+func (c *NonceCache) Use(nonce []byte, expires time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n := time.Now()
+	for k, e := range c.nonces {
+		if n.After(e) {
+			delete(c.nonces, k)
+		}
+	}
+	k := string(nonce)
+	if _, ok := c.nonces[k]; ok {
+		return false
+	}
+	c.nonces[k] = expires
+	return true
+}
+
+// SignState returns the state with an additional item containing the HMAC
+// signature.
+func (s *HMACStateSigner) SignState(state []string) ([]string, error) {
+	if len(s.Key) == 0 {
+		return nil, fmt.Errorf("Key required")
+	}
+	if s.Issuer == "" {
+		return nil, fmt.Errorf("Issuer required")
+	}
+	t, err := newStateToken(stateKindHMAC, s.Issuer, s.TTL)
+	if err != nil {
+		return nil, err
+	}
+	d, err := t.digest(state)
+	if err != nil {
+		return nil, err
+	}
+	m := hmac.New(sha256.New, s.Key)
+	m.Write(d)
+	t.sig = m.Sum(nil)
+	return t.appendTo(state)
+}
+
+// SignState returns the state with an additional item containing an OWID
+// that signs the state.
+func (s *OWIDStateSigner) SignState(state []string) ([]string, error) {
+	if s.Creator == nil {
+		return nil, fmt.Errorf("Creator required")
+	}
+	t, err := newStateToken(stateKindOWID, s.Creator.Domain(), s.TTL)
+	if err != nil {
+		return nil, err
+	}
+	d, err := t.digest(state)
+	if err != nil {
+		return nil, err
+	}
+	o, err := s.Creator.CreateOWIDandSign(d)
+	if err != nil {
+		return nil, err
+	}
+	t.sig, err = o.AsByteArray()
+	if err != nil {
+		return nil, err
+	}
+	return t.appendTo(state)
+}
+
+// VerifyState returns the state without the signature item if the state was
+// signed by a trusted issuer, has not been modified, has not expired and has
+// not been verified before. Otherwise an error wrapping one of the ErrState
+// errors is returned.
+func (v *StateVerifier) VerifyState(state []string) ([]string, error) {
+	if len(state) == 0 ||
+		strings.HasPrefix(state[len(state)-1], stateTokenPrefix) == false {
+		return nil, ErrStateUnsigned
+	}
+	s := state[:len(state)-1]
+	t, err := parseStateToken(state[len(state)-1])
+	if err != nil {
+		return nil, err
+	}
+	d, err := t.digest(s)
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case stateKindHMAC:
+		err = v.verifyHMAC(t, d)
+	case stateKindOWID:
+		err = v.verifyOWID(t, d)
+	default:
+		err = fmt.Errorf("state signature '%d' not supported", t.kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := time.Now()
+	if n.After(t.expires) {
+		return nil, ErrStateExpired
+	}
+	if t.issued.After(n.Add(stateClockSkew)) {
+		return nil, fmt.Errorf("issued in the future: %w", ErrStateModified)
+	}
+	if v.Nonces != nil && v.Nonces.Use(t.nonce, t.expires) == false {
+		return nil, ErrStateReplayed
+	}
+	return append([]string{}, s...), nil
+}
+
+func (v *StateVerifier) verifyHMAC(t *stateToken, d []byte) error {
+	k := v.Keys[t.issuer]
+	if len(k) == 0 {
+		return fmt.Errorf("'%s': %w", t.issuer, ErrStateIssuer)
+	}
+	m := hmac.New(sha256.New, k)
+	m.Write(d)
+	if hmac.Equal(m.Sum(nil), t.sig) == false {
+		return ErrStateModified
+	}
+	return nil
+}
+
+func (v *StateVerifier) verifyOWID(t *stateToken, d []byte) error {
+	if containsString(v.Issuers, t.issuer) == false {
+		return fmt.Errorf("'%s': %w", t.issuer, ErrStateIssuer)
+	}
+	o, err := owid.FromByteArray(t.sig)
+	if err != nil {
+		return err
+	}
+	if o.Domain != t.issuer {
+		return fmt.Errorf("'%s': %w", o.Domain, ErrStateIssuer)
+	}
+	if bytes.Equal(o.Payload, d) == false {
+		return ErrStateModified
+	}
+	var ok bool
+	if k, f := v.PublicKeys[o.Domain]; f {
+		ok, err = o.VerifyWithPublicKey(k)
+	} else {
+		ok, err = o.Verify(stringOrDefault(v.Scheme, "https"))
+	}
+	if err != nil {
+		return err
+	}
+	if ok == false {
+		return ErrStateModified
+	}
+	return nil
+}
+
+// newStateToken returns a new token with a random nonce.
+func newStateToken(
+	kind byte,
+	issuer string,
+	ttl time.Duration) (*stateToken, error) {
+	if ttl <= 0 {
+		ttl = stateDefaultTTL
+	}
+	n := make([]byte, stateNonceLength)
+	_, err := rand.Read(n)
+	if err != nil {
+		return nil, err
+	}
+	i := time.Now().UTC().Truncate(time.Second)
+	return &stateToken{
+		kind:    kind,
+		issuer:  issuer,
+		nonce:   n,
+		issued:  i,
+		expires: i.Add(ttl),
+	}, nil
+}
+
+// writeHeader writes the fields of the token other than the signature.
+func (t *stateToken) writeHeader(f *bytes.Buffer) error {
+	err := writeByte(f, stateTokenVersion)
+	if err != nil {
+		return err
+	}
+	err = writeByte(f, t.kind)
+	if err != nil {
+		return err
+	}
+	err = writeString(f, t.issuer)
+	if err != nil {
+		return err
+	}
+	err = writeByteArray(f, t.nonce)
+	if err != nil {
+		return err
+	}
+	err = writeTime(f, t.issued)
+	if err != nil {
+		return err
+	}
+	return writeTime(f, t.expires)
+}
+
+// digest returns the SHA-256 hash of the token header and the state items
+// that is signed.
+func (t *stateToken) digest(state []string) ([]byte, error) {
+	var f bytes.Buffer
+	err := t.writeHeader(&f)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write(f.Bytes())
+	l := make([]byte, 4)
+	for _, s := range state {
+		binary.LittleEndian.PutUint32(l, uint32(len(s)))
+		h.Write(l)
+		h.Write([]byte(s))
+	}
+	return h.Sum(nil), nil
+}
+
+// appendTo returns a copy of the state with the token appended.
+func (t *stateToken) appendTo(state []string) ([]string, error) {
+	var f bytes.Buffer
+	err := t.writeHeader(&f)
+	if err != nil {
+		return nil, err
+	}
+	err = writeByteArray(&f, t.sig)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]string, 0, len(state)+1)
+	r = append(r, state...)
+	return append(
+		r,
+		stateTokenPrefix+base64.RawURLEncoding.EncodeToString(f.Bytes())), nil
+}
+
+// parseStateToken returns the token in the state item s.
+func parseStateToken(s string) (*stateToken, error) {
+	b, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimPrefix(s, stateTokenPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrStateModified)
+	}
+	f := bytes.NewBuffer(b)
+	v, err := readByte(f)
+	if err != nil {
+		return nil, err
+	}
+	if v != stateTokenVersion {
+		return nil, fmt.Errorf("state version '%d' not supported", v)
+	}
+	var t stateToken
+	t.kind, err = readByte(f)
+	if err != nil {
+		return nil, err
+	}
+	t.issuer, err = readString(f)
+	if err != nil {
+		return nil, err
+	}
+	t.nonce, err = readByteArray(f)
+	if err != nil {
+		return nil, err
+	}
+	t.issued, err = readTime(f)
+	if err != nil {
+		return nil, err
+	}
+	t.expires, err = readTime(f)
+	if err != nil {
+		return nil, err
+	}
+	t.sig, err = readByteArray(f)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTrailing(f)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// RawState returns the state from the result of DecryptRaw.
+func RawState(raw map[string]interface{}) []string {
+	a, _ := raw["state"].([]interface{})
+	s := make([]string, 0, len(a))
+	for _, i := range a {
+		if v, ok := i.(string); ok {
+			s = append(s, v)
+		}
+	}
+	return s
+}
+
+// containsString returns true if the list of strings contains v.
+func containsString(l []string, v string) bool {
+	for _, i := range l {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStateRelay checks that state signed by the party that relays an Update
+// with GetValues is signed only once by the party that receives the values.
+func TestStateRelay(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://cmp.com/", nil)
+	e := []string{"page", "42"}
+	a := testConnection(Operation{StateSigner: &HMACStateSigner{
+		Issuer: "cmp.com",
+		Key:    []byte("cmp key")}})
+	u := a.NewUpdate(r, "https://publisher.com/swan", WithState(e...))
+	v, err := u.GetValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v["state"], e) {
+		t.Fatalf("values state '%v' expected '%v'", v["state"], e)
+	}
+
+	// Values from earlier versions contain the signature which is removed.
+	s, err := u.StateSigner.SignState(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v["state"] = s
+
+	k := []byte("publisher key")
+	b := testConnection(Operation{StateSigner: &HMACStateSigner{
+		Issuer: "publisher.com",
+		Key:    k}})
+	p, err := UpdateFromValues(b, r, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.State, e) {
+		t.Fatalf("relayed state '%v' expected '%v'", p.State, e)
+	}
+	d := url.Values{}
+	err = p.setData(&d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &StateVerifier{
+		Keys:   map[string][]byte{"publisher.com": k},
+		Nonces: NewNonceCache()}
+	g, err := f.VerifyState(d["state"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g, e) {
+		t.Fatalf("verified state '%v' expected '%v'", g, e)
+	}
+}
+
+func TestVerifyState(t *testing.T) {
+	e := []string{"page", "42"}
+	k := []byte("publisher key")
+	g := &HMACStateSigner{Issuer: "publisher.com", Key: k}
+	v := &StateVerifier{
+		Keys: map[string][]byte{
+			"publisher.com": k,
+			"cmp.com":       []byte("cmp key")},
+		Issuers: []string{"cmp.com"},
+		Nonces:  NewNonceCache()}
+	n := time.Now().UTC().Truncate(time.Second)
+
+	s, err := g.SignState(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := v.VerifyState(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, e) {
+		t.Fatalf("'%v' expected '%v'", r, e)
+	}
+	_, err = v.VerifyState(s)
+	testStateError(t, "replayed", err, ErrStateReplayed)
+
+	s, err = g.SignState(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := append([]string{"page", "43"}, s[len(e):]...)
+	_, err = v.VerifyState(m)
+	testStateError(t, "modified", err, ErrStateModified)
+	_, err = v.VerifyState(s[1:])
+	testStateError(t, "removed", err, ErrStateModified)
+	_, err = v.VerifyState(e)
+	testStateError(t, "unsigned", err, ErrStateUnsigned)
+	_, err = v.VerifyState(nil)
+	testStateError(t, "empty", err, ErrStateUnsigned)
+
+	// A key known to the verifier can not be used to sign as another issuer.
+	s, err = (&HMACStateSigner{Issuer: "cmp.com", Key: k}).SignState(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.VerifyState(s)
+	testStateError(t, "wrong key", err, ErrStateModified)
+	s, err = (&HMACStateSigner{Issuer: "evil.com", Key: k}).SignState(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.VerifyState(s)
+	testStateError(t, "unknown issuer", err, ErrStateIssuer)
+	s = testSignState(t, stateKindOWID, "evil.com", nil, n, n.Add(time.Hour), e)
+	_, err = v.VerifyState(s)
+	testStateError(t, "OWID issuer", err, ErrStateIssuer)
+
+	s = testSignState(
+		t,
+		stateKindHMAC,
+		"publisher.com",
+		k,
+		n.Add(-time.Hour),
+		n.Add(-time.Minute),
+		e)
+	_, err = v.VerifyState(s)
+	testStateError(t, "expired", err, ErrStateExpired)
+	s = testSignState(
+		t,
+		stateKindHMAC,
+		"publisher.com",
+		k,
+		n.Add(time.Hour),
+		n.Add(2*time.Hour),
+		e)
+	_, err = v.VerifyState(s)
+	testStateError(t, "future", err, ErrStateModified)
+}
+
+// testSignState returns the state signed with a token with the times provided.
+// The HMAC is used if the key is not nil.
+func testSignState(
+	t *testing.T,
+	kind byte,
+	issuer string,
+	key []byte,
+	issued time.Time,
+	expires time.Time,
+	state []string) []string {
+	t.Helper()
+	k, err := newStateToken(kind, issuer, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.issued = issued
+	k.expires = expires
+	if key != nil {
+		d, err := k.digest(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := hmac.New(sha256.New, key)
+		m.Write(d)
+		k.sig = m.Sum(nil)
+	}
+	s, err := k.appendTo(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func testStateError(t *testing.T, n string, err error, e error) {
+	t.Helper()
+	if errors.Is(err, e) == false {
+		t.Fatalf("%s error '%v' expected '%v'", n, err, e)
+	}
+}
@@ -0,0 +1,340 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+	"golang.org/x/net/idna"
+)
+
+// Prefixes and suffixes used to encode stop list entries in the ID.Stopped
+// strings. Entries without a prefix are hosts so that stop lists written by
+// earlier versions continue to be understood.
+const (
+	stopSubdomainsPrefix = "."
+	stopAdvertPrefix     = "advert:"
+	stopExpiresSeparator = ";expires="
+)
+
+// StopKind is the kind of an entry in a stop list.
+type StopKind byte
+
+// Kinds of entries in a stop list.
+const (
+	StopHost           StopKind = iota // The host only
+	StopHostSubdomains StopKind = iota // The host and all its subdomains
+	StopAdvert         StopKind = iota // An advert identified by its OWID
+)
+
+// StopEntry is a single host or advert that should not be shown.
+type StopEntry struct {
+	Kind StopKind
+	// Normalized host for StopHost and StopHostSubdomains, or the base 64 OWID
+	// for StopAdvert.
+	Value string
+	// The UTC time after which the entry no longer applies, or the zero time
+	// if the entry does not expire.
+	Expires time.Time
+}
+
+// StopList is a collection of hosts and adverts that should not be shown. It
+// is encoded into the ID.Stopped field for transmission. Use ID.StopList to
+// get the stop list for an ID. The zero value is an empty stop list.
+type StopList struct {
+	entries []*StopEntry
+	hosts   map[string]*StopEntry // Keyed on the normalized host
+	domains map[string]*StopEntry // Keyed on the normalized host
+	adverts map[string]*StopEntry // Keyed on the base 64 OWID
+}
+
+// NewStopList returns a new empty stop list.
+func NewStopList() *StopList {
+	return &StopList{
+		hosts:   make(map[string]*StopEntry),
+		domains: make(map[string]*StopEntry),
+		adverts: make(map[string]*StopEntry)}
+}
+
+// ParseStopList returns the stop list encoded in the strings from the
+// ID.Stopped field. Empty strings are ignored. Entries without a prefix that
+// are not valid hosts are treated as advert identifiers. If any entry is
+// invalid the first error is returned along with a stop list containing the
+// valid entries.
+func ParseStopList(s []string) (*StopList, error) {
+	var err error
+	l := NewStopList()
+	for _, i := range s {
+		if i == "" {
+			continue
+		}
+		e, ee := parseStopEntry(i)
+		if ee != nil {
+			if err == nil {
+				err = ee
+			}
+			continue
+		}
+		l.Add(e)
+	}
+	return l, err
+}
+
+// NormalizeHost returns the host in the form used for matching. Accepts a
+// host or a URL. Ports and trailing dots are removed, the host is converted
+// to lower case and internationalized domain names are converted to punycode.
+func NormalizeHost(h string) (string, error) {
+	s := strings.TrimSpace(h)
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", err
+		}
+		s = u.Host
+	}
+	if i, _, err := net.SplitHostPort(s); err == nil {
+		s = i
+	}
+	s = strings.TrimRight(s, ".")
+	if s == "" {
+		return "", fmt.Errorf("host '%s' invalid", h)
+	}
+	if ip := net.ParseIP(strings.Trim(s, "[]")); ip != nil {
+		return ip.String(), nil
+	}
+	a, err := idna.Lookup.ToASCII(s)
+	if err != nil {
+		return "", fmt.Errorf("host '%s' invalid: %w", h, err)
+	}
+	return a, nil
+}
+
+// AddHost adds the host, which can also be a URL, to the stop list. If
+// subdomains is true then all the subdomains of the host are also stopped.
+// The zero time is used for entries that do not expire.
+func (l *StopList) AddHost(
+	host string,
+	subdomains bool,
+	expires time.Time) error {
+	h, err := NormalizeHost(host)
+	if err != nil {
+		return err
+	}
+	e := &StopEntry{Kind: StopHost, Value: h, Expires: expires}
+	if subdomains {
+		e.Kind = StopHostSubdomains
+	}
+	l.Add(e)
+	return nil
+}
+
+// AddAdvert adds the advert identified by the OWID to the stop list. The zero
+// time is used for entries that do not expire.
+func (l *StopList) AddAdvert(o *owid.OWID, expires time.Time) error {
+	s, err := o.AsBase64()
+	if err != nil {
+		return err
+	}
+	l.Add(&StopEntry{Kind: StopAdvert, Value: s, Expires: expires})
+	return nil
+}
+
+// Add adds the entry to the stop list replacing any entry of the same kind
+// with the same value.
+func (l *StopList) Add(e *StopEntry) {
+	m := l.entryMap(e.Kind)
+	if _, ok := m[e.Value]; ok {
+		l.Remove(e.Kind, e.Value)
+	}
+	m[e.Value] = e
+	l.entries = append(l.entries, e)
+}
+
+// Remove removes the entry of the kind with the value. Returns true if an
+// entry was removed.
+func (l *StopList) Remove(k StopKind, v string) bool {
+	m := l.entryMap(k)
+	e, ok := m[v]
+	if ok == false {
+		return false
+	}
+	delete(m, v)
+	for i, n := range l.entries {
+		if n == e {
+			l.entries = append(l.entries[:i], l.entries[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// RemoveExpired removes the entries that have expired.
+func (l *StopList) RemoveExpired() {
+	n := time.Now()
+	for _, e := range append([]*StopEntry(nil), l.entries...) {
+		if e.isExpired(n) {
+			l.Remove(e.Kind, e.Value)
+		}
+	}
+}
+
+// Entries returns the entries in the order they were added.
+func (l *StopList) Entries() []*StopEntry {
+	return append([]*StopEntry(nil), l.entries...)
+}
+
+// IsStopped returns true if the host of the URL provided, which can also be a
+// host with or without a path, is stopped and the entry has not expired. The
+// value is also matched against the advert entries so that advert identifiers
+// in stop lists written by earlier versions are still found.
+func (l *StopList) IsStopped(u string) bool {
+	n := time.Now()
+	if e, ok := l.adverts[u]; ok && e.isExpired(n) == false {
+		return true
+	}
+	h, err := NormalizeHost(stripPath(u))
+	if err != nil {
+		return false
+	}
+	if e, ok := l.hosts[h]; ok && e.isExpired(n) == false {
+		return true
+	}
+	for {
+		if e, ok := l.domains[h]; ok && e.isExpired(n) == false {
+			return true
+		}
+		i := strings.IndexByte(h, '.')
+		if i < 0 {
+			return false
+		}
+		h = h[i+1:]
+	}
+}
+
+// IsAdvertStopped returns true if the advert identified by the OWID is
+// stopped and the entry has not expired.
+func (l *StopList) IsAdvertStopped(o *owid.OWID) bool {
+	s, err := o.AsBase64()
+	if err != nil {
+		return false
+	}
+	e, ok := l.adverts[s]
+	return ok && e.isExpired(time.Now()) == false
+}
+
+// AsStrings returns the stop list encoded for use in the ID.Stopped field.
+func (l *StopList) AsStrings() []string {
+	s := make([]string, 0, len(l.entries))
+	for _, e := range l.entries {
+		s = append(s, e.String())
+	}
+	return s
+}
+
+// String returns the entry encoded for use in the ID.Stopped field.
+func (e *StopEntry) String() string {
+	var s string
+	switch e.Kind {
+	case StopHostSubdomains:
+		s = stopSubdomainsPrefix + e.Value
+	case StopAdvert:
+		s = stopAdvertPrefix + e.Value
+	default:
+		s = e.Value
+	}
+	if e.Expires.IsZero() == false {
+		s += stopExpiresSeparator + strconv.FormatInt(e.Expires.Unix(), 10)
+	}
+	return s
+}
+
+// stripPath returns the host and port of a URL without a scheme by removing
+// any path, query or fragment. URLs with a scheme are returned unchanged.
+func stripPath(u string) string {
+	if strings.Contains(u, "://") {
+		return u
+	}
+	if i := strings.IndexAny(u, "/?#"); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
+
+func (e *StopEntry) isExpired(n time.Time) bool {
+	return e.Expires.IsZero() == false && n.After(e.Expires)
+}
+
+// entryMap returns the map for the kind of entry creating the maps if needed
+// so that the zero value StopList can be used.
+func (l *StopList) entryMap(k StopKind) map[string]*StopEntry {
+	if l.hosts == nil {
+		l.hosts = make(map[string]*StopEntry)
+		l.domains = make(map[string]*StopEntry)
+		l.adverts = make(map[string]*StopEntry)
+	}
+	switch k {
+	case StopHostSubdomains:
+		return l.domains
+	case StopAdvert:
+		return l.adverts
+	default:
+		return l.hosts
+	}
+}
+
+func parseStopEntry(s string) (*StopEntry, error) {
+	var e StopEntry
+	if i := strings.LastIndex(s, stopExpiresSeparator); i >= 0 {
+		t, err := strconv.ParseInt(s[i+len(stopExpiresSeparator):], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("stop entry '%s' expiry invalid", s)
+		}
+		e.Expires = time.Unix(t, 0).UTC()
+		s = s[:i]
+	}
+	switch {
+	case strings.HasPrefix(s, stopAdvertPrefix):
+		e.Kind = StopAdvert
+		e.Value = s[len(stopAdvertPrefix):]
+		if e.Value == "" {
+			return nil, fmt.Errorf("stop entry advert missing")
+		}
+		return &e, nil
+	case strings.HasPrefix(s, stopSubdomainsPrefix):
+		e.Kind = StopHostSubdomains
+		s = s[len(stopSubdomainsPrefix):]
+	default:
+		e.Kind = StopHost
+	}
+	h, err := NormalizeHost(s)
+	if err != nil {
+		if e.Kind == StopHost {
+			e.Kind = StopAdvert
+			e.Value = s
+			return &e, nil
+		}
+		return nil, err
+	}
+	e.Value = h
+	return &e, nil
+}
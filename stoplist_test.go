@@ -0,0 +1,101 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStopListIsStopped(t *testing.T) {
+	future := time.Now().Add(time.Hour).Unix()
+	l, err := ParseStopList([]string{
+		"example.com",
+		".sub.example.org",
+		"expired.com;expires=1",
+		"later.com;expires=" + strconv.FormatInt(future, 10),
+		"AQIDBAUGBwgJ+/==",
+		"advert:AAAA",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		value   string
+		stopped bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com.", true},
+		{"example.com:8080", true},
+		{"https://example.com/ad.png", true},
+		{"example.com/ad.png", true},
+		{"example.com?id=1", true},
+		{"www.example.com", false},
+		{"sub.example.org", true},
+		{"a.b.sub.example.org/path", true},
+		{"example.org", false},
+		{"expired.com", false},
+		{"later.com", true},
+		{"AQIDBAUGBwgJ+/==", true},
+		{"AAAA", true},
+		{"other.com", false},
+		{"", false},
+	} {
+		if l.IsStopped(c.value) != c.stopped {
+			t.Errorf("'%s' stopped should be %v", c.value, c.stopped)
+		}
+	}
+}
+
+// TestIDIsStoppedLegacy checks that the entries in stop lists written by
+// earlier versions match as they did before StopList.
+func TestIDIsStoppedLegacy(t *testing.T) {
+	i := &ID{Stopped: []string{"advertiser.com", "AQIDBAUGBwgJ+/=="}}
+	for _, s := range i.Stopped {
+		if !i.IsStopped(s) {
+			t.Errorf("'%s' not stopped", s)
+		}
+	}
+}
+
+// TestStopListZero checks that the zero value can be used without
+// NewStopList.
+func TestStopListZero(t *testing.T) {
+	var l StopList
+	if l.IsStopped("pub.com") || l.Remove(StopHost, "pub.com") {
+		t.Fatal("zero value not empty")
+	}
+	err := l.AddHost("https://Pub.com/ad", false, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.AddAdvert(testOWID("dsp.com", []byte{1}), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Add(&StopEntry{Kind: StopHostSubdomains, Value: "cdn.com"})
+	if l.IsStopped("pub.com") == false || l.IsStopped("a.cdn.com") == false {
+		t.Fatal("hosts not stopped")
+	}
+	if l.IsAdvertStopped(testOWID("dsp.com", []byte{1})) == false {
+		t.Fatal("advert not stopped")
+	}
+	if len(l.AsStrings()) != 3 {
+		t.Fatalf("'%v' expected 3 entries", l.AsStrings())
+	}
+}
@@ -0,0 +1,471 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Values used in the core segment of an IAB TCF version 2 TC string.
+const (
+	tcfVersion          = 2
+	tcfPolicyVersion    = 4  // TCF 2.2
+	tcfPurposes         = 24 // Bits used for purposes
+	tcfSpecialFeatures  = 12 // Bits used for special features
+	tcfSegmentSeparator = "."
+)
+
+// MaxTCFVendors is the maximum total number of vendor ids read from the vendor
+// consents, vendor legitimate interests and publisher restrictions of a TC
+// string. Ranges allow a short TC string to list a very large number of ids so
+// strings that exceed the limit are rejected before the ids are allocated.
+var MaxTCFVendors = 1 << 16
+
+// TCF purposes that the SWAN preferences map to. Purpose 1, storing and
+// accessing information on a device, is needed for any personalization.
+var (
+	tcfPurposesStorage                = []int{1}
+	tcfPurposesPersonalizedAds        = []int{3, 4}
+	tcfPurposesContentPersonalization = []int{5, 6}
+	tcfPurposesMeasurement            = []int{7, 8, 9}
+	// Purposes that TCF 2.2 does not allow to rely on legitimate interest.
+	tcfPurposesConsentOnly = []int{1, 3, 4, 5, 6}
+)
+
+// TCString is the core segment of an IAB Transparency and Consent Framework
+// version 2 TC string. Purposes, special features and vendors are lists of
+// their ids.
+type TCString struct {
+	Version                   int       // Version of the TC string, always 2
+	Created                   time.Time // When the TC string was created
+	LastUpdated               time.Time // When the TC string was last updated
+	CmpID                     int       // IAB registered id of the CMP
+	CmpVersion                int       // Version of the CMP
+	ConsentScreen             int       // CMP screen where consent was given
+	ConsentLanguage           string    // Two letter ISO 639-1 language
+	VendorListVersion         int       // Version of the global vendor list
+	PolicyVersion             int       // Version of the TCF policy
+	IsServiceSpecific         bool      // True if only for the service
+	UseNonStandardTexts       bool      // True if non standard texts were used
+	SpecialFeatureOptIns      []int     // Special features opted into
+	PurposesConsent           []int     // Purposes with consent
+	PurposesLITransparency    []int     // Purposes with legitimate interest
+	PurposeOneTreatment       bool      // True if purpose 1 was not disclosed
+	PublisherCC               string    // Two letter ISO 3166-1 country code
+	VendorConsents            []int     // Vendors with consent
+	VendorLegitimateInterests []int     // Vendors with legitimate interest
+	PublisherRestrictions     []*TCRestriction
+}
+
+// TCRestriction is a publisher restriction for a purpose and a list of
+// vendors.
+type TCRestriction struct {
+	PurposeID       int   // Purpose restricted
+	RestrictionType int   // 0 not allowed, 1 consent, 2 legitimate interest
+	Vendors         []int // Vendors the restriction applies to
+}
+
+// TCFConfig contains the values needed to create a TC string that are not part
+// of the SWAN preferences.
+type TCFConfig struct {
+	CmpID             int    // IAB registered id of the CMP
+	CmpVersion        int    // Version of the CMP
+	ConsentScreen     int    // CMP screen where consent was given
+	ConsentLanguage   string // Two letter ISO 639-1 language, default EN
+	VendorListVersion int    // Version of the global vendor list
+	PolicyVersion     int    // Version of the TCF policy, default 4
+	PublisherCC       string // Two letter ISO 3166-1 country code, default AA
+	// Vendors given consent for the purposes allowed by the preferences.
+	Vendors []int
+	// Purposes the publisher relies on legitimate interest for. Set in
+	// PurposesLITransparency unless the preferences do not allow the purpose.
+	// Purposes 1 and 3 to 6 can not use legitimate interest in TCF 2.2.
+	LegitimateInterests []int
+	// Vendors given legitimate interest for the LegitimateInterests purposes.
+	LegitimateInterestVendors []int
+}
+
+// NewTCString returns the TC string for the preferences using the config for
+// the values that are not part of the preferences. The created and last
+// updated times are the day of the preferences Timestamp. The PolicyVersion
+// of the preferences is not part of the TC string.
+func (c *TCFConfig) NewTCString(p *Preferences) (*TCString, error) {
+	if p == nil {
+		return nil, fmt.Errorf("preferences required")
+	}
+	if c.CmpID <= 0 {
+		return nil, fmt.Errorf("CmpID required")
+	}
+	if c.VendorListVersion <= 0 {
+		return nil, fmt.Errorf("VendorListVersion required")
+	}
+	for _, i := range c.LegitimateInterests {
+		if i < 1 || i > tcfPurposes || containsInt(tcfPurposesConsentOnly, i) {
+			return nil, fmt.Errorf(
+				"purpose '%d' can not use legitimate interest",
+				i)
+		}
+	}
+	t := TCString{
+		Version:           tcfVersion,
+		CmpID:             c.CmpID,
+		CmpVersion:        c.CmpVersion,
+		ConsentScreen:     c.ConsentScreen,
+		ConsentLanguage:   stringOrDefault(c.ConsentLanguage, "EN"),
+		VendorListVersion: c.VendorListVersion,
+		PolicyVersion:     c.PolicyVersion,
+		PublisherCC:       stringOrDefault(c.PublisherCC, "AA"),
+	}
+	if t.PolicyVersion == 0 {
+		t.PolicyVersion = tcfPolicyVersion
+	}
+	d := p.Timestamp
+	if d.IsZero() {
+		d = time.Now()
+	}
+	t.Created = d.UTC().Truncate(24 * time.Hour)
+	t.LastUpdated = t.Created
+	var o []int
+	if p.PersonalizedAds {
+		o = append(o, tcfPurposesPersonalizedAds...)
+	}
+	if p.ContentPersonalization {
+		o = append(o, tcfPurposesContentPersonalization...)
+	}
+	if p.Measurement {
+		o = append(o, tcfPurposesMeasurement...)
+	}
+	if len(o) > 0 {
+		t.PurposesConsent = append(t.PurposesConsent, tcfPurposesStorage...)
+		t.PurposesConsent = append(t.PurposesConsent, o...)
+		t.VendorConsents = append([]int{}, c.Vendors...)
+	}
+	for _, i := range c.LegitimateInterests {
+		if p.objectsTo(i) == false {
+			t.PurposesLITransparency = append(t.PurposesLITransparency, i)
+		}
+	}
+	if len(t.PurposesLITransparency) > 0 {
+		t.VendorLegitimateInterests = append(
+			[]int{},
+			c.LegitimateInterestVendors...)
+	}
+	t.normalize()
+	return &t, nil
+}
+
+// PreferencesToTCString returns the TC string for the preferences. See
+// TCFConfig.NewTCString.
+func PreferencesToTCString(p *Preferences, c *TCFConfig) (string, error) {
+	t, err := c.NewTCString(p)
+	if err != nil {
+		return "", err
+	}
+	return t.AsString()
+}
+
+// PreferencesFromTCString returns the preferences for the TC string. See
+// TCString.Preferences.
+func PreferencesFromTCString(s string) (*Preferences, error) {
+	t, err := ParseTCString(s)
+	if err != nil {
+		return nil, err
+	}
+	return t.Preferences(), nil
+}
+
+// Preferences returns the SWAN preferences for the TC string. A SWAN purpose
+// is allowed if all the TCF purposes it maps to have consent. Measurement can
+// also be allowed with legitimate interest. Personalization also needs consent
+// for purpose 1. The Timestamp is LastUpdated.
+func (t *TCString) Preferences() *Preferences {
+	p := NewPreferences()
+	s := containsAll(t.PurposesConsent, tcfPurposesStorage)
+	p.PersonalizedAds = s &&
+		containsAll(t.PurposesConsent, tcfPurposesPersonalizedAds)
+	p.ContentPersonalization = s &&
+		containsAll(t.PurposesConsent, tcfPurposesContentPersonalization)
+	for _, i := range tcfPurposesMeasurement {
+		p.Measurement = containsInt(t.PurposesConsent, i) ||
+			containsInt(t.PurposesLITransparency, i)
+		if p.Measurement == false {
+			break
+		}
+	}
+	p.Timestamp = t.LastUpdated
+	return p
+}
+
+// objectsTo returns true if the preferences do not allow the SWAN purpose that
+// the TCF purpose i maps to.
+func (p *Preferences) objectsTo(i int) bool {
+	switch {
+	case containsInt(tcfPurposesPersonalizedAds, i):
+		return p.PersonalizedAds == false
+	case containsInt(tcfPurposesContentPersonalization, i):
+		return p.ContentPersonalization == false
+	case containsInt(tcfPurposesMeasurement, i):
+		return p.Measurement == false
+	}
+	return false
+}
+
+// AsString returns the TC string with only the core segment.
+func (t *TCString) AsString() (string, error) {
+	var w bitWriter
+	w.writeInt(t.Version, 6)
+	w.writeDeciseconds(t.Created)
+	w.writeDeciseconds(t.LastUpdated)
+	w.writeInt(t.CmpID, 12)
+	w.writeInt(t.CmpVersion, 12)
+	w.writeInt(t.ConsentScreen, 6)
+	w.writeLetters(t.ConsentLanguage, 2)
+	w.writeInt(t.VendorListVersion, 12)
+	w.writeInt(t.PolicyVersion, 6)
+	w.writeBool(t.IsServiceSpecific)
+	w.writeBool(t.UseNonStandardTexts)
+	w.writeBitField(t.SpecialFeatureOptIns, tcfSpecialFeatures)
+	w.writeBitField(t.PurposesConsent, tcfPurposes)
+	w.writeBitField(t.PurposesLITransparency, tcfPurposes)
+	w.writeBool(t.PurposeOneTreatment)
+	w.writeLetters(t.PublisherCC, 2)
+	w.writeVendors(t.VendorConsents)
+	w.writeVendors(t.VendorLegitimateInterests)
+	w.writeInt(len(t.PublisherRestrictions), 12)
+	for _, r := range t.PublisherRestrictions {
+		w.writeInt(r.PurposeID, 6)
+		w.writeInt(r.RestrictionType, 2)
+		w.writeRanges(r.Vendors)
+	}
+	return w.asBase64()
+}
+
+// ParseTCString returns the core segment of the TC string. Other segments are
+// ignored.
+func ParseTCString(s string) (*TCString, error) {
+	c := strings.Split(s, tcfSegmentSeparator)[0]
+	if c == "" {
+		return nil, fmt.Errorf("TC string empty")
+	}
+	r, err := newBitReader(c)
+	if err != nil {
+		return nil, err
+	}
+	var t TCString
+	t.Version = r.readInt(6)
+	if r.err == nil && t.Version != tcfVersion {
+		return nil, fmt.Errorf("TC string version '%d' not supported", t.Version)
+	}
+	t.Created = r.readDeciseconds()
+	t.LastUpdated = r.readDeciseconds()
+	t.CmpID = r.readInt(12)
+	t.CmpVersion = r.readInt(12)
+	t.ConsentScreen = r.readInt(6)
+	t.ConsentLanguage = r.readLetters(2)
+	t.VendorListVersion = r.readInt(12)
+	t.PolicyVersion = r.readInt(6)
+	t.IsServiceSpecific = r.readBool()
+	t.UseNonStandardTexts = r.readBool()
+	t.SpecialFeatureOptIns = r.readBitField(tcfSpecialFeatures)
+	t.PurposesConsent = r.readBitField(tcfPurposes)
+	t.PurposesLITransparency = r.readBitField(tcfPurposes)
+	t.PurposeOneTreatment = r.readBool()
+	t.PublisherCC = r.readLetters(2)
+	b := MaxTCFVendors
+	t.VendorConsents = r.readVendors(&b)
+	t.VendorLegitimateInterests = r.readVendors(&b)
+	// Publisher restrictions are absent from some older TC strings.
+	if r.err == nil && r.remaining() >= 12 {
+		n := r.readInt(12)
+		for i := 0; i < n && r.err == nil; i++ {
+			var p TCRestriction
+			p.PurposeID = r.readInt(6)
+			p.RestrictionType = r.readInt(2)
+			p.Vendors = r.readRanges(&b)
+			t.PublisherRestrictions = append(t.PublisherRestrictions, &p)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &t, nil
+}
+
+// normalize sorts the lists of ids and removes duplicates so that the encoding
+// is the same for the same ids.
+func (t *TCString) normalize() {
+	t.SpecialFeatureOptIns = sortedInts(t.SpecialFeatureOptIns)
+	t.PurposesConsent = sortedInts(t.PurposesConsent)
+	t.PurposesLITransparency = sortedInts(t.PurposesLITransparency)
+	t.VendorConsents = sortedInts(t.VendorConsents)
+	t.VendorLegitimateInterests = sortedInts(t.VendorLegitimateInterests)
+}
+
+// writeVendors writes a vendor section using a bit field or ranges, whichever
+// is shorter.
+func (w *bitWriter) writeVendors(v []int) {
+	v = sortedInts(v)
+	m := 0
+	if len(v) > 0 {
+		m = v[len(v)-1]
+	}
+	w.writeInt(m, 16)
+	r := vendorRanges(v)
+	l := 12
+	for _, i := range r {
+		l += 17
+		if i[0] != i[1] {
+			l += 16
+		}
+	}
+	if l < m {
+		w.writeBool(true)
+		w.writeVendorRanges(r)
+	} else {
+		w.writeBool(false)
+		w.writeBitField(v, m)
+	}
+}
+
+// writeRanges writes the vendors as ranges.
+func (w *bitWriter) writeRanges(v []int) {
+	w.writeVendorRanges(vendorRanges(sortedInts(v)))
+}
+
+func (w *bitWriter) writeVendorRanges(r [][2]int) {
+	w.writeInt(len(r), 12)
+	for _, i := range r {
+		w.writeBool(i[0] != i[1])
+		w.writeInt(i[0], 16)
+		if i[0] != i[1] {
+			w.writeInt(i[1], 16)
+		}
+	}
+}
+
+// readVendors reads a vendor section. The number of vendor ids read is
+// subtracted from the budget which must not become negative.
+func (r *bitReader) readVendors(budget *int) []int {
+	m := r.readInt(16)
+	if r.readBool() {
+		return r.readRanges(budget)
+	}
+	v := r.readBitField(m)
+	r.spendVendors(budget, len(v))
+	if r.err != nil {
+		return nil
+	}
+	return v
+}
+
+// readRanges reads vendor ranges. The number of vendor ids in the ranges is
+// subtracted from the budget before any are allocated.
+func (r *bitReader) readRanges(budget *int) []int {
+	var v []int
+	n := r.readInt(12)
+	for i := 0; i < n && r.err == nil; i++ {
+		a := r.readBool()
+		s := r.readInt(16)
+		e := s
+		if a {
+			e = r.readInt(16)
+		}
+		if r.err != nil {
+			return nil
+		}
+		if e < s {
+			r.err = fmt.Errorf("vendor range '%d' to '%d' invalid", s, e)
+			return nil
+		}
+		r.spendVendors(budget, e-s+1)
+		if r.err != nil {
+			return nil
+		}
+		for j := s; j <= e; j++ {
+			v = append(v, j)
+		}
+	}
+	if r.err != nil {
+		return nil
+	}
+	return v
+}
+
+// spendVendors subtracts n vendor ids from the budget setting the error if
+// the budget is exceeded.
+func (r *bitReader) spendVendors(budget *int, n int) {
+	if r.err != nil {
+		return
+	}
+	*budget -= n
+	if *budget < 0 {
+		r.err = fmt.Errorf(
+			"vendors exceed '%d': %w",
+			MaxTCFVendors,
+			ErrTooLong)
+	}
+}
+
+// vendorRanges returns the sorted ids as ranges of consecutive ids.
+func vendorRanges(v []int) [][2]int {
+	var r [][2]int
+	for _, i := range v {
+		if len(r) > 0 && r[len(r)-1][1] == i-1 {
+			r[len(r)-1][1] = i
+		} else {
+			r = append(r, [2]int{i, i})
+		}
+	}
+	return r
+}
+
+// sortedInts returns a sorted copy of the integers without duplicates.
+func sortedInts(l []int) []int {
+	if len(l) == 0 {
+		return nil
+	}
+	s := append([]int{}, l...)
+	sort.Ints(s)
+	r := s[:1]
+	for _, i := range s[1:] {
+		if i != r[len(r)-1] {
+			r = append(r, i)
+		}
+	}
+	return r
+}
+
+// containsAll returns true if the list l contains all the values v.
+func containsAll(l []int, v []int) bool {
+	for _, i := range v {
+		if containsInt(l, i) == false {
+			return false
+		}
+	}
+	return true
+}
+
+// stringOrDefault returns s, or d if s is empty.
+func stringOrDefault(s string, d string) string {
+	if s == "" {
+		return d
+	}
+	return s
+}
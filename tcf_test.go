@@ -0,0 +1,255 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TC strings from the IAB Transparency and Consent Framework documentation and
+// test decoder.
+const (
+	testTCStringEmpty   = "CPXxRfAPXxRfAAfKABENB-CgAAAAAAAAAAYgAAAAAAAA"
+	testTCStringVendors = "COvFyGBOvFyGBAbAAAENAPCAAOAAAAAAAAAAAEEUACCKAAA"
+	testTCStringSegment = "CLcVDxRMWfGmWAVAHCENAXCkAKDAADnAABRgA5mdfCKZuYJe" +
+		"z-NQm0TBMYA4oCAAGQYIAAAAAAEAIAEgAA.argAC0gAAAAAAAAAAAA"
+)
+
+func TestTCStringEmpty(t *testing.T) {
+	c := testTCParse(t, testTCStringEmpty)
+	d := time.Date(2022, time.April, 20, 22, 0, 0, 0, time.UTC)
+	if !c.Created.Equal(d) || !c.LastUpdated.Equal(d) {
+		t.Fatalf("dates '%s' '%s' expected '%s'", c.Created, c.LastUpdated, d)
+	}
+	if c.CmpID != 31 || c.CmpVersion != 640 || c.ConsentScreen != 1 {
+		t.Fatalf("CMP '%d' '%d' '%d'", c.CmpID, c.CmpVersion, c.ConsentScreen)
+	}
+	if c.ConsentLanguage != "EN" || c.PublisherCC != "DE" {
+		t.Fatalf("language '%s' country '%s'", c.ConsentLanguage, c.PublisherCC)
+	}
+	if c.VendorListVersion != 126 || c.PolicyVersion != 2 {
+		t.Fatalf("versions '%d' '%d'", c.VendorListVersion, c.PolicyVersion)
+	}
+	if c.IsServiceSpecific == false || len(c.PurposesConsent) != 0 ||
+		len(c.VendorConsents) != 0 {
+		t.Fatalf("'%+v' not empty", c)
+	}
+	testTCReencode(t, c, testTCStringEmpty)
+}
+
+func TestTCStringVendors(t *testing.T) {
+	c := testTCParse(t, testTCStringVendors)
+	testTCInts(t, "purposes", c.PurposesConsent, []int{1, 2, 3})
+	testTCInts(t, "vendors", c.VendorConsents, []int{2, 6, 8})
+	testTCInts(t, "interests", c.VendorLegitimateInterests, []int{2, 6, 8})
+	if c.CmpID != 27 || c.VendorListVersion != 15 || c.PublisherCC != "AA" {
+		t.Fatalf("'%+v' unexpected", c)
+	}
+	testTCReencode(t, c, testTCStringVendors)
+}
+
+// TestTCStringSegment checks that segments after the core segment are ignored
+// and that the core segment survives encoding, which may choose a different
+// vendor encoding to the original.
+func TestTCStringSegment(t *testing.T) {
+	c := testTCParse(t, testTCStringSegment)
+	testTCInts(t, "special features", c.SpecialFeatureOptIns, []int{2})
+	testTCInts(t, "purposes", c.PurposesConsent, []int{1, 3, 9, 10})
+	testTCInts(
+		t,
+		"interests",
+		c.VendorLegitimateInterests,
+		[]int{1, 9, 26, 27, 30, 36, 37, 43, 86, 97, 110, 113})
+	if len(c.VendorConsents) != 56 || c.PublisherCC != "KM" {
+		t.Fatalf("'%+v' unexpected", c)
+	}
+	s, err := c.AsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := testTCParse(t, s); !reflect.DeepEqual(c, d) {
+		t.Fatalf("'%+v' expected '%+v'", d, c)
+	}
+}
+
+func TestTCStringRestrictions(t *testing.T) {
+	c := testTCParse(t, testTCStringVendors)
+	c.PublisherRestrictions = []*TCRestriction{
+		{PurposeID: 2, RestrictionType: 1, Vendors: []int{1, 2, 3, 10}},
+		{PurposeID: 7, RestrictionType: 0, Vendors: []int{8}}}
+	s, err := c.AsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := testTCParse(t, s); !reflect.DeepEqual(c, d) {
+		t.Fatalf("'%+v' expected '%+v'", d, c)
+	}
+}
+
+// TestTCStringVendorBudget checks that a short TC string with many publisher
+// restrictions that each cover every vendor is rejected.
+func TestTCStringVendorBudget(t *testing.T) {
+	c := testTCParse(t, testTCStringEmpty)
+	a := make([]int, 0, 65535)
+	for i := 1; i <= 65535; i++ {
+		a = append(a, i)
+	}
+	for i := 0; i < 300; i++ {
+		c.PublisherRestrictions = append(
+			c.PublisherRestrictions,
+			&TCRestriction{PurposeID: 1, Vendors: a})
+	}
+	s, err := c.AsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseTCString(s)
+	if !errors.Is(err, ErrTooLong) {
+		t.Fatalf("error '%v' expected '%v'", err, ErrTooLong)
+	}
+	c.PublisherRestrictions = c.PublisherRestrictions[:1]
+	s, err = c.AsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTCParse(t, s)
+}
+
+func testTCParse(t *testing.T, s string) *TCString {
+	c, err := ParseTCString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func testTCReencode(t *testing.T, c *TCString, e string) {
+	s, err := c.AsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != e {
+		t.Fatalf("'%s' expected '%s'", s, e)
+	}
+}
+
+func testTCInts(t *testing.T, n string, v []int, e []int) {
+	if !reflect.DeepEqual(v, e) {
+		t.Fatalf("%s '%v' expected '%v'", n, v, e)
+	}
+}
+
+// testTCFConfig returns a config with legitimate interest for measurement.
+func testTCFConfig() *TCFConfig {
+	return &TCFConfig{
+		CmpID:                     31,
+		CmpVersion:                1,
+		VendorListVersion:         126,
+		Vendors:                   []int{8, 2, 6},
+		LegitimateInterests:       []int{7, 8},
+		LegitimateInterestVendors: []int{6}}
+}
+
+func TestPreferencesToTCString(t *testing.T) {
+	on := testPreferences()
+	on.Measurement = true
+	off := testPreferences()
+	off.PersonalizedAds = false
+	stop := newLegacyPreferences(false)
+	stop.Timestamp = off.Timestamp
+	for _, v := range []struct {
+		n         string
+		p         *Preferences
+		consent   []int
+		li        []int
+		vendors   []int
+		liVendors []int
+	}{
+		{"personalized", on, []int{1, 3, 4, 5, 6, 7, 8, 9}, []int{7, 8},
+			[]int{2, 6, 8}, []int{6}},
+		{"not personalized", off, []int{1, 5, 6}, nil, []int{2, 6, 8}, nil},
+		{"stop", stop, nil, nil, nil, nil},
+	} {
+		c, err := testTCFConfig().NewTCString(v.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testTCInts(t, v.n+" consent", c.PurposesConsent, v.consent)
+		testTCInts(t, v.n+" li", c.PurposesLITransparency, v.li)
+		testTCInts(t, v.n+" vendors", c.VendorConsents, v.vendors)
+		testTCInts(
+			t,
+			v.n+" li vendors",
+			c.VendorLegitimateInterests,
+			v.liVendors)
+		d := time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC)
+		if c.Created.Equal(d) == false || c.CmpID != 31 ||
+			c.VendorListVersion != 126 || c.PolicyVersion != tcfPolicyVersion {
+			t.Fatalf("%s '%+v' unexpected", v.n, c)
+		}
+
+		s, err := PreferencesToTCString(v.p, testTCFConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := PreferencesFromTCString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.PersonalizedAds != v.p.PersonalizedAds ||
+			p.ContentPersonalization != v.p.ContentPersonalization ||
+			p.Measurement != v.p.Measurement ||
+			p.Timestamp.Equal(d) == false {
+			t.Fatalf("%s '%+v' expected '%+v'", v.n, p, v.p)
+		}
+	}
+}
+
+// TestTCStringPreferences checks that measurement is allowed with legitimate
+// interest but personalization needs consent for purpose 1.
+func TestTCStringPreferences(t *testing.T) {
+	p := (&TCString{
+		PurposesConsent:        []int{3, 4, 5, 6, 7},
+		PurposesLITransparency: []int{8, 9}}).Preferences()
+	if p.PersonalizedAds || p.ContentPersonalization || p.Measurement == false {
+		t.Fatalf("'%+v' unexpected", p)
+	}
+	p = testTCParse(t, testTCStringVendors).Preferences()
+	if p.PersonalizedAds || p.ContentPersonalization || p.Measurement {
+		t.Fatalf("'%+v' unexpected", p)
+	}
+}
+
+func TestNewTCStringInvalid(t *testing.T) {
+	for _, i := range []int{0, 1, 3, 4, 5, 6, 25} {
+		c := testTCFConfig()
+		c.LegitimateInterests = []int{i}
+		if _, err := c.NewTCString(testPreferences()); err == nil {
+			t.Fatalf("legitimate interest for '%d' expected error", i)
+		}
+	}
+	if _, err := (&TCFConfig{VendorListVersion: 1}).NewTCString(
+		testPreferences()); err == nil {
+		t.Fatal("expected error for missing CmpID")
+	}
+	if _, err := testTCFConfig().NewTCString(nil); err == nil {
+		t.Fatal("expected error for nil preferences")
+	}
+}
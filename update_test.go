@@ -0,0 +1,113 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestUpdatePatch checks that Patch and the Change of each field survive
+// setData and UpdateFromValues.
+func TestUpdatePatch(t *testing.T) {
+	c := testConnection(Operation{})
+	r := httptest.NewRequest("GET", "https://cmp.com/", nil)
+	for _, patch := range []bool{false, true} {
+		u := c.NewUpdate(r, "https://pub.com/swan")
+		u.Patch = patch
+		pref, err := testOWID("cmp.com", []byte(prefOn)).AsBase64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = u.SetPrefFromOWID(pref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.ClearEmail() // Salt and SWID are not set
+
+		e := map[string]Change{
+			"pref":  ChangeSet,
+			"email": ChangeClear,
+			"salt":  ChangeNone,
+			"swid":  ChangeNone}
+		if patch == false {
+			e["salt"] = ChangeClear
+			e["swid"] = ChangeClear
+		}
+		a := map[string]Change{
+			"pref":  u.PrefChange(),
+			"email": u.EmailChange(),
+			"salt":  u.SaltChange(),
+			"swid":  u.SWIDChange()}
+		testChanges(t, patch, a, e)
+
+		q := url.Values{}
+		err = u.setData(&q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Has("patch") != patch {
+			t.Fatalf("patch '%t' values '%v'", patch, q)
+		}
+		if q.Get("pref") != pref {
+			t.Fatalf("pref '%s' expected '%s'", q.Get("pref"), pref)
+		}
+		// Cleared fields are sent as empty values with a patch, otherwise
+		// fields are only sent when set.
+		if q.Has("email") != patch || q.Get("email") != "" {
+			t.Fatalf("patch '%t' email '%v'", patch, q["email"])
+		}
+		if q.Has("salt") || q.Has("swid") {
+			t.Fatalf("patch '%t' unset fields sent '%v'", patch, q)
+		}
+
+		v, err := u.GetValues()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := UpdateFromValues(c, r, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Patch != patch {
+			t.Fatalf("patch '%t' expected '%t'", p.Patch, patch)
+		}
+		delete(e, "swid") // Not included in the values
+		a = map[string]Change{
+			"pref":  p.PrefChange(),
+			"email": p.EmailChange(),
+			"salt":  p.SaltChange()}
+		testChanges(t, patch, a, e)
+		if p.Pref().AsString() != u.Pref().AsString() {
+			t.Fatal("pref not relayed")
+		}
+	}
+}
+
+func testChanges(
+	t *testing.T,
+	patch bool,
+	a map[string]Change,
+	e map[string]Change) {
+	t.Helper()
+	for k, v := range e {
+		if a[k] != v {
+			t.Fatalf("patch '%t' %s '%s' expected '%s'", patch, k, a[k], v)
+		}
+	}
+}
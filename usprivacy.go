@@ -0,0 +1,178 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"fmt"
+)
+
+// Version of the IAB US Privacy string.
+const usPrivacyVersion = '1'
+
+// USJurisdiction is the US privacy law that a GPP string section is for.
+type USJurisdiction byte
+
+// Jurisdictions with GPP sections that SWAN preferences can be mapped to.
+const (
+	// US national privacy, GPP section usnat.
+	USNational USJurisdiction = iota
+	// California privacy, GPP section usca.
+	USCalifornia USJurisdiction = iota
+)
+
+// USPrivacy contains the US privacy signals derived from SWAN preferences.
+type USPrivacy struct {
+	Notice                    bool // Notice of the right to opt out was given
+	OptOutSale                bool // True if opted out of the sale of data
+	OptOutSharing             bool // True if opted out of sharing of data
+	OptOutTargetedAdvertising bool // True if opted out of targeted adverts
+	// True if the transaction is covered by the IAB Limited Service Provider
+	// Agreement or the Multi-State Privacy Agreement.
+	LSPACovered bool
+}
+
+// USPrivacyConfig contains the values needed to create US privacy signals that
+// are not part of the SWAN preferences.
+type USPrivacyConfig struct {
+	Jurisdiction USJurisdiction // The GPP section to use
+	Notice       bool           // True if notice of the right to opt out given
+	LSPACovered  bool           // True if covered by the LSPA or MSPA
+	// True if the publisher uses the MSPA service provider mode, otherwise
+	// the opt out option mode is used. Only used if LSPACovered is true.
+	ServiceProviderMode bool
+	// True if the GPP string should also contain the US Privacy string
+	// section for parties that have not yet moved to the US sections.
+	IncludeUSPrivacy bool
+}
+
+// String returns the name of the GPP section for the jurisdiction.
+func (j USJurisdiction) String() string {
+	switch j {
+	case USNational:
+		return "usnat"
+	case USCalifornia:
+		return "usca"
+	default:
+		return "unknown"
+	}
+}
+
+// NewUSPrivacy returns the US privacy signals for the ID. The user is opted out
+// of sale, sharing and targeted advertising if the preferences of the ID do not
+// allow personalized adverts, or if the recipient host of the signals has been
+// stopped by the user. The recipient can be empty if not known.
+//
+// id containing the preferences and stopped list
+//
+// recipient host or URL of the party the signals will be sent to
+func (c *USPrivacyConfig) NewUSPrivacy(
+	id *ID,
+	recipient string) (*USPrivacy, error) {
+	if id == nil {
+		return nil, fmt.Errorf("id required")
+	}
+	p, err := id.PreferencesAsStruct()
+	if err != nil {
+		return nil, err
+	}
+	o := p == nil || p.PersonalizedAds == false
+	if o == false && recipient != "" {
+		l, _ := id.StopList()
+		o = l.IsStopped(recipient)
+	}
+	return &USPrivacy{
+		Notice:                    c.Notice,
+		OptOutSale:                o,
+		OptOutSharing:             o,
+		OptOutTargetedAdvertising: o,
+		LSPACovered:               c.LSPACovered,
+	}, nil
+}
+
+// Preferences returns the SWAN preferences for the US privacy signals.
+// Personalized adverts are allowed if the user has not opted out of sale,
+// sharing or targeted advertising. The US signals do not cover measurement or
+// content personalization which are allowed.
+func (u *USPrivacy) Preferences() *Preferences {
+	p := NewPreferences()
+	p.PersonalizedAds = u.OptOutSale == false &&
+		u.OptOutSharing == false &&
+		u.OptOutTargetedAdvertising == false
+	p.Measurement = true
+	p.ContentPersonalization = true
+	return p
+}
+
+// USPrivacyString returns the four character IAB US Privacy string. The opt
+// out of sale character is set if the user opted out of sale or sharing.
+func (u *USPrivacy) USPrivacyString() string {
+	return string([]byte{
+		usPrivacyVersion,
+		usPrivacyFlag(u.Notice),
+		usPrivacyFlag(u.OptOutSale || u.OptOutSharing),
+		usPrivacyFlag(u.LSPACovered)})
+}
+
+// ParseUSPrivacyString returns the US privacy signals in the IAB US Privacy
+// string. Values that are not applicable, indicated by a dash, are false. The
+// opt out of sale character sets the sale, sharing and targeted advertising
+// opt outs.
+func ParseUSPrivacyString(s string) (*USPrivacy, error) {
+	if len(s) != 4 {
+		return nil, fmt.Errorf("US Privacy string '%s' must be 4 characters", s)
+	}
+	if s[0] != usPrivacyVersion {
+		return nil, fmt.Errorf(
+			"US Privacy string version '%c' not supported",
+			s[0])
+	}
+	var u USPrivacy
+	var err error
+	u.Notice, err = parseUSPrivacyFlag(s[1])
+	if err != nil {
+		return nil, err
+	}
+	u.OptOutSale, err = parseUSPrivacyFlag(s[2])
+	if err != nil {
+		return nil, err
+	}
+	u.OptOutSharing = u.OptOutSale
+	u.OptOutTargetedAdvertising = u.OptOutSale
+	u.LSPACovered, err = parseUSPrivacyFlag(s[3])
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func usPrivacyFlag(v bool) byte {
+	if v {
+		return 'Y'
+	}
+	return 'N'
+}
+
+func parseUSPrivacyFlag(c byte) (bool, error) {
+	switch c {
+	case 'Y', 'y':
+		return true, nil
+	case 'N', 'n', '-':
+		return false, nil
+	default:
+		return false, fmt.Errorf("US Privacy string value '%c' invalid", c)
+	}
+}
@@ -0,0 +1,115 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"testing"
+)
+
+func TestUSPrivacyString(t *testing.T) {
+	for _, v := range []struct {
+		s string
+		u USPrivacy
+		e string // Expected string after encoding
+	}{
+		{"1NNN", USPrivacy{}, "1NNN"},
+		{"1YNN", USPrivacy{Notice: true}, "1YNN"},
+		{"1YYY", USPrivacy{
+			Notice:                    true,
+			OptOutSale:                true,
+			OptOutSharing:             true,
+			OptOutTargetedAdvertising: true,
+			LSPACovered:               true}, "1YYY"},
+		{"1---", USPrivacy{}, "1NNN"},
+		{"1yyn", USPrivacy{
+			Notice:                    true,
+			OptOutSale:                true,
+			OptOutSharing:             true,
+			OptOutTargetedAdvertising: true}, "1YYN"},
+	} {
+		u, err := ParseUSPrivacyString(v.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *u != v.u {
+			t.Fatalf("'%s' gave '%+v' expected '%+v'", v.s, u, v.u)
+		}
+		if s := u.USPrivacyString(); s != v.e {
+			t.Fatalf("'%s' expected '%s'", s, v.e)
+		}
+	}
+	for _, s := range []string{"", "1YN", "2YNN", "1XNN"} {
+		if _, err := ParseUSPrivacyString(s); err == nil {
+			t.Fatalf("'%s' expected error", s)
+		}
+	}
+}
+
+func TestNewUSPrivacy(t *testing.T) {
+	b, err := testPreferences().AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := testPreferences()
+	off.PersonalizedAds = false
+	o, err := off.AsByteArray()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &USPrivacyConfig{Notice: true}
+	for _, v := range []struct {
+		n         string
+		pref      []byte // Payload of the preferences, or nil if none
+		stopped   []string
+		recipient string
+		e         string // Expected US Privacy string
+	}{
+		{"personalized", b, nil, "dsp.com", "1YNN"},
+		{"legacy on", []byte(prefOn), nil, "", "1YNN"},
+		{"not personalized", o, nil, "dsp.com", "1YYN"},
+		{"legacy off", []byte(prefOff), nil, "", "1YYN"},
+		{"nil preferences", nil, nil, "dsp.com", "1YYN"},
+		{"stopped", b, []string{"dsp.com"}, "https://dsp.com/bid", "1YYN"},
+		{"other stopped", b, []string{"dsp.com"}, "ssp.com", "1YNN"},
+	} {
+		i := testID()
+		i.Stopped = v.stopped
+		i.Preferences = nil
+		if v.pref != nil {
+			i.Preferences = testOWID("cmp.com", v.pref)
+		}
+		u, err := c.NewUSPrivacy(i, v.recipient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := u.USPrivacyString(); s != v.e {
+			t.Fatalf("%s '%s' expected '%s'", v.n, s, v.e)
+		}
+		if u.OptOutSale != u.OptOutSharing ||
+			u.OptOutSale != u.OptOutTargetedAdvertising {
+			t.Fatalf("%s '%+v' opt outs differ", v.n, u)
+		}
+	}
+	if _, err := c.NewUSPrivacy(nil, ""); err == nil {
+		t.Fatal("expected error for nil ID")
+	}
+	i := testID()
+	i.Preferences = testOWID("cmp.com", []byte{0xff})
+	if _, err := c.NewUSPrivacy(i, ""); err == nil {
+		t.Fatal("expected error for invalid preferences")
+	}
+}
@@ -0,0 +1,202 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// Names of the fields used in validation errors.
+const (
+	fieldEmail = "email"
+	fieldSalt  = "salt"
+)
+
+// Limits for email addresses from RFC 5321.
+const (
+	maxEmailLength      = 254
+	maxEmailLocalLength = 64
+	maxDomainLabel      = 63
+)
+
+// Length of the salt-js salt which is 4 selections from a grid of 16 images
+// with each selection stored in 4 bits.
+const (
+	saltBytes        = 2
+	saltLength       = 3 // Base 64 characters without padding
+	saltPaddedLength = 4 // Base 64 characters with padding
+)
+
+// Characters other than letters and digits that are allowed in the local part
+// of an email address.
+const emailLocalSpecials = "!#$%&'*+/=?^_`{|}~-"
+
+// ValidateEmail returns a *ValidationError if the email address is not valid.
+// The practical subset of RFC 5322 used by mail providers is supported which
+// excludes quoted strings, comments and IP address literals. The domain can
+// contain international characters. Use ValidateEmailIDN to also check that
+// international domains are valid.
+func ValidateEmail(email string) error {
+	_, err := splitEmail(email)
+	return err
+}
+
+// ValidateEmailIDN is the same as ValidateEmail and also checks that the
+// domain is a valid internationalized domain name.
+func ValidateEmailIDN(email string) error {
+	d, err := splitEmail(email)
+	if err != nil {
+		return err
+	}
+	_, err = idna.Registration.ToASCII(d)
+	if err != nil {
+		return newValidationError(fieldEmail, email, "domain %s", err)
+	}
+	return nil
+}
+
+// ValidateSalt returns a *ValidationError if the salt is not a base 64 salt
+// string from salt-js. The salt must be 3 base 64 characters, or 4 with
+// padding, that decode to 2 bytes.
+func ValidateSalt(salt string) error {
+	_, err := decodeSalt(salt)
+	return err
+}
+
+// splitEmail validates the email returning the domain.
+func splitEmail(email string) (string, error) {
+	if email == "" {
+		return "", newValidationError(fieldEmail, email, "required")
+	}
+	if len(email) > maxEmailLength {
+		return "", newValidationError(
+			fieldEmail,
+			email,
+			"longer than %d characters",
+			maxEmailLength)
+	}
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return "", newValidationError(fieldEmail, email, "@ missing")
+	}
+	l, d := email[:i], email[i+1:]
+	if l == "" {
+		return "", newValidationError(fieldEmail, email, "name missing")
+	}
+	if len(l) > maxEmailLocalLength {
+		return "", newValidationError(
+			fieldEmail,
+			email,
+			"name longer than %d characters",
+			maxEmailLocalLength)
+	}
+	for _, a := range strings.Split(l, ".") {
+		if a == "" {
+			return "", newValidationError(
+				fieldEmail,
+				email,
+				"name must not start or end with a dot or contain two dots")
+		}
+		for _, c := range a {
+			if isAlphaNumeric(c) == false &&
+				strings.ContainsRune(emailLocalSpecials, c) == false {
+				return "", newValidationError(
+					fieldEmail,
+					email,
+					"name must not contain '%c'",
+					c)
+			}
+		}
+	}
+	if d == "" {
+		return "", newValidationError(fieldEmail, email, "domain missing")
+	}
+	p := strings.Split(d, ".")
+	if len(p) < 2 {
+		return "", newValidationError(
+			fieldEmail,
+			email,
+			"domain must contain a dot")
+	}
+	for _, a := range p {
+		if a == "" || utf8.RuneCountInString(a) > maxDomainLabel {
+			return "", newValidationError(
+				fieldEmail,
+				email,
+				"domain label '%s' invalid",
+				a)
+		}
+		if a[0] == '-' || a[len(a)-1] == '-' {
+			return "", newValidationError(
+				fieldEmail,
+				email,
+				"domain label '%s' must not start or end with a hyphen",
+				a)
+		}
+		for _, c := range a {
+			if c != '-' && isAlphaNumeric(c) == false && c < utf8.RuneSelf {
+				return "", newValidationError(
+					fieldEmail,
+					email,
+					"domain must not contain '%c'",
+					c)
+			}
+		}
+	}
+	if strings.Trim(p[len(p)-1], "0123456789") == "" {
+		return "", newValidationError(
+			fieldEmail,
+			email,
+			"top level domain must not be numeric")
+	}
+	return d, nil
+}
+
+// decodeSalt returns the bytes of the base 64 encoded salt from salt-js.
+func decodeSalt(salt string) ([]byte, error) {
+	if salt == "" {
+		return nil, newValidationError(fieldSalt, salt, "required")
+	}
+	if len(salt) != saltLength && len(salt) != saltPaddedLength {
+		return nil, newValidationError(
+			fieldSalt,
+			salt,
+			"must be %d characters",
+			saltLength)
+	}
+	e := base64.RawStdEncoding.Strict()
+	b, err := e.DecodeString(strings.TrimRight(salt, "="))
+	if err != nil || len(b) != saltBytes {
+		return nil, newValidationError(
+			fieldSalt,
+			salt,
+			"must be base 64 encoded %d bytes",
+			saltBytes)
+	}
+	return b, nil
+}
+
+// isAlphaNumeric returns true if c is an ASCII letter or digit.
+func isAlphaNumeric(c rune) bool {
+	return (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9')
+}
@@ -0,0 +1,138 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swan
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestValidateEmail(t *testing.T) {
+	d := strings.Repeat("a", 63)
+	for _, v := range []struct {
+		email string
+		ok    bool
+		idn   bool // Expected result from ValidateEmailIDN
+	}{
+		{"jane@example.com", true, true},
+		{"jane.doe+news@mail.example.co.uk", true, true},
+		{"o'brien!#$%&*/=?^_`{|}~-@example.com", true, true},
+		{"user@bücher.example", true, true},
+		{"user@xn--bcher-kva.example", true, true},
+		{"user@a‍.example", true, false},
+		{strings.Repeat("a", 64) + "@example.com", true, true},
+		{"a@" + d + "." + d + "." + d + "." + strings.Repeat("a", 61) + ".com",
+			false, false},
+		{"", false, false},
+		{"jane.example.com", false, false},
+		{"@example.com", false, false},
+		{strings.Repeat("a", 65) + "@example.com", false, false},
+		{"jane@", false, false},
+		{"jane@localhost", false, false},
+		{"jane@example.123", false, false},
+		{"jane@-example.com", false, false},
+		{"jane@example-.com", false, false},
+		{"jane@exa_mple.com", false, false},
+		{"jane@" + strings.Repeat("a", 64) + ".com", false, false},
+		{"jane@example..com", false, false},
+		{".jane@example.com", false, false},
+		{"jane.@example.com", false, false},
+		{"ja..ne@example.com", false, false},
+		{"ja ne@example.com", false, false},
+		{"ja\"ne@example.com", false, false},
+	} {
+		err := ValidateEmail(v.email)
+		testValidation(t, v.email, err, v.ok, fieldEmail)
+		err = ValidateEmailIDN(v.email)
+		testValidation(t, v.email, err, v.idn, fieldEmail)
+	}
+}
+
+func TestValidateSalt(t *testing.T) {
+	for _, v := range []struct {
+		salt string
+		ok   bool
+	}{
+		{"qqo", true},
+		{"qqo=", true},
+		{"AQI", true},
+		{"", false},
+		{"qq", false},
+		{"qqoo", false},
+		{"qqo==", false},
+		{"qq*", false},
+		{"qqp", false}, // Non zero trailing bits are not canonical
+		{"q-_", false},
+	} {
+		testValidation(t, v.salt, ValidateSalt(v.salt), v.ok, fieldSalt)
+	}
+}
+
+// TestUpdateFromValuesValidates checks that emails and salts provided as OWIDs
+// are validated.
+func TestUpdateFromValuesValidates(t *testing.T) {
+	c := testConnection(Operation{})
+	r := httptest.NewRequest("GET", "https://cmp.com/", nil)
+	for _, v := range []struct {
+		k  string
+		p  string
+		ok bool
+	}{
+		{"email", "jane@example.com", true},
+		{"email", "", true},
+		{"email", "not an email", false},
+		{"salt", "qqo", true},
+		{"salt", "not a salt", false},
+	} {
+		o, err := testOWID("cmp.com", []byte(v.p)).AsBase64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = UpdateFromValues(c, r, url.Values{
+			"returnUrl": {"https://pub.com/swan"},
+			v.k:         {o}})
+		testValidation(t, v.p, err, v.ok, v.k)
+		u := c.NewUpdate(r, "https://pub.com/swan")
+		if v.k == "email" {
+			err = u.SetEmailFromOWID(o)
+		} else {
+			err = u.SetSaltFromOWID(o)
+		}
+		if v.ok != (err == nil) {
+			t.Fatalf("'%s' error '%v'", v.p, err)
+		}
+	}
+}
+
+// testValidation checks err is nil if ok is true, or a *ValidationError for
+// the field f.
+func testValidation(t *testing.T, v string, err error, ok bool, f string) {
+	t.Helper()
+	if ok {
+		if err != nil {
+			t.Fatalf("'%s' %s", v, err)
+		}
+		return
+	}
+	var e *ValidationError
+	if errors.As(err, &e) == false || e.Field != f {
+		t.Fatalf("'%s' error '%v' expected for %s", v, err, f)
+	}
+}